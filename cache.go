@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// summaryCache holds the latest scrape of every node, as made by the
+// exporter's background poll, so that any number of Prometheus replicas can
+// be served without adding kubelet load.
+type summaryCache struct {
+	mu      sync.RWMutex
+	scrapes map[string]nodeScrape
+}
+
+// newSummaryCache returns an empty cache.
+func newSummaryCache() *summaryCache {
+	return &summaryCache{scrapes: make(map[string]nodeScrape)}
+}
+
+// set caches s as the latest scrape of its node.
+func (c *summaryCache) set(s nodeScrape) {
+	c.mu.Lock()
+	c.scrapes[s.node] = s
+	c.mu.Unlock()
+}
+
+// retain drops the cached scrapes of nodes other than nodes, i.e. nodes that
+// are no longer in the cluster.
+func (c *summaryCache) retain(nodes []string) {
+	keep := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		keep[node] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for node := range c.scrapes {
+		if !keep[node] {
+			delete(c.scrapes, node)
+		}
+	}
+}
+
+// get returns the cached scrape of node.
+func (c *summaryCache) get(node string) (nodeScrape, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s, ok := c.scrapes[node]
+	return s, ok
+}
+
+// list returns the cached scrapes of nodes, skipping nodes not yet polled.
+func (c *summaryCache) list(nodes []string) []nodeScrape {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	scrapes := make([]nodeScrape, 0, len(nodes))
+	for _, node := range nodes {
+		if s, ok := c.scrapes[node]; ok {
+			scrapes = append(scrapes, s)
+		}
+	}
+	return scrapes
+}
+
+// poll scrapes every node into e.cache every interval until ctx is done. The
+// first poll starts immediately; until it finishes the cache is empty.
+func (e *exporter) poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		e.pollOnce(ctx, interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollOnce scrapes every node into e.cache, caching each node's scrape as
+// soon as it finishes so a slow kubelet does not hold back the others. Each
+// fetch is bounded by e.fetchTimeout, and the whole poll by timeout so it
+// cannot delay the next one.
+func (e *exporter) pollOnce(ctx context.Context, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	nodes, _, err := e.listNodes(nodeFilter{})
+	if err != nil {
+		slog.Error("list nodes", "err", err)
+		return
+	}
+	for s := range e.streamNodes(ctx, nodes) {
+		e.cache.set(s)
+	}
+	e.cache.retain(nodes)
+}
+
+// lastGoodCache holds the last successful scrape of every node, so a node
+// whose scrapes start failing keeps being served from its last summary for a
+// while instead of its series disappearing, which breaks absent() and rate()
+// based alerts.
+type lastGoodCache struct {
+	// window is how long after it was fetched a summary may be served in
+	// place of failed scrapes.
+	window time.Duration
+
+	mu        sync.Mutex
+	scrapes   map[string]nodeScrape
+	lastPrune time.Time
+}
+
+// newLastGoodCache returns an empty cache serving summaries for up to window.
+func newLastGoodCache(window time.Duration) *lastGoodCache {
+	return &lastGoodCache{
+		window:  window,
+		scrapes: make(map[string]nodeScrape),
+	}
+}
+
+// resolve records s if it succeeded and returns it unchanged. If s failed or
+// the node was skipped, it returns s with the summary of the node's last
+// successful scrape when that was fetched within window of s; s keeps its
+// error or skip reason, so the node is still reported as failing or skipped.
+func (c *lastGoodCache) resolve(s nodeScrape) nodeScrape {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop expired summaries now and then, so those of deleted nodes do not
+	// accumulate.
+	if s.time.Sub(c.lastPrune) > c.window {
+		for node, good := range c.scrapes {
+			if s.time.Sub(good.fetched) > c.window {
+				delete(c.scrapes, node)
+			}
+		}
+		c.lastPrune = s.time
+	}
+
+	if s.err == nil && s.skipped == "" {
+		c.scrapes[s.node] = s
+		return s
+	}
+	good, ok := c.scrapes[s.node]
+	if !ok || s.time.Sub(good.fetched) > c.window {
+		return s
+	}
+	s.summary, s.fetched = good.summary, good.fetched
+	return s
+}
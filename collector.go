@@ -0,0 +1,218 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+// Label names shared by every metric describing the same level of the
+// summary. Metrics that need more labels declare them in their metric entry.
+var (
+	nodeLabelNames            = []string{"node"}
+	systemContainerLabelNames = []string{"node", "system_container"}
+	podLabelNames             = []string{"node", "pod", "uid", "namespace"}
+	containerLabelNames       = []string{"node", "pod", "uid", "namespace", "name"}
+	volumeLabelNames          = []string{"node", "pod", "uid", "namespace", "name", "persistentvolumeclaim", "pvc_namespace"}
+)
+
+// metric declares a single summary metric, exported for every object of type
+// T: the node, a system container, a pod, a container or a volume of a
+// stats.Summary. Its series carry the labels of its metricSet followed by
+// labels.
+type metric[T any] struct {
+	name      string // without the metricsNamespace prefix
+	help      string
+	valueType prometheus.ValueType
+	labels    []string
+
+	// collect sends the metric's series for x through e. Metrics with
+	// extra labels send one series per set of extra label values.
+	collect func(e *emitter, x T)
+
+	desc *prometheus.Desc
+}
+
+// metricSet is the table of metrics exported for one level of the summary.
+type metricSet[T any] struct {
+	labels  []string
+	metrics []metric[T]
+}
+
+// newMetricSet concatenates metrics into a metricSet labelled with labels and
+// builds their Descs. Descs are built once at startup and shared by every
+// request; only the samples themselves are created per scrape.
+func newMetricSet[T any](labels []string, metrics ...[]metric[T]) *metricSet[T] {
+	s := &metricSet[T]{labels: labels, metrics: slices.Concat(metrics...)}
+	for i := range s.metrics {
+		m := &s.metrics[i]
+		m.desc = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", m.name), m.help, slices.Concat(labels, m.labels), nil)
+	}
+	return s
+}
+
+// describe sends the Desc of every metric in s.
+func (s *metricSet[T]) describe(ch chan<- *prometheus.Desc) {
+	for i := range s.metrics {
+		ch <- s.metrics[i].desc
+	}
+}
+
+// collect sends the series of every metric in s for x, labelled with labels.
+func (s *metricSet[T]) collect(e *emitter, x T, labels []string) {
+	for i := range s.metrics {
+		m := &s.metrics[i]
+		e.desc, e.valueType, e.labels = m.desc, m.valueType, labels
+		m.collect(e, x)
+	}
+}
+
+// metricDoc documents a metric in the README metrics table.
+type metricDoc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+// docs returns the documentation of every metric in s.
+func (s *metricSet[T]) docs() []metricDoc {
+	docs := make([]metricDoc, 0, len(s.metrics))
+	for _, m := range s.metrics {
+		docs = append(docs, metricDoc{
+			name:   prometheus.BuildFQName(metricsNamespace, "", m.name),
+			help:   m.help,
+			labels: slices.Concat(s.labels, m.labels),
+		})
+	}
+	return docs
+}
+
+// describer is implemented by every metricSet, whatever level of the summary
+// it exports.
+type describer interface {
+	describe(ch chan<- *prometheus.Desc)
+	docs() []metricDoc
+}
+
+// emitter sends the series of the metric being collected; metricSet.collect
+// points it at each metric in turn. It is not safe for concurrent use, so
+// each Collect uses its own.
+type emitter struct {
+	ch chan<- prometheus.Metric
+
+	// userDefinedMetrics and now are the summaryCollector's, for the
+	// metrics that need them.
+	userDefinedMetrics map[string]bool
+	now                time.Time
+
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	labels    []string
+
+	// buf is reused to append extra label values to labels.
+	buf []string
+}
+
+// emit sends v labelled with the current labels followed by extraLabels.
+func (e *emitter) emit(v float64, extraLabels ...string) {
+	labels := e.labels
+	if len(extraLabels) > 0 {
+		e.buf = append(append(e.buf[:0], e.labels...), extraLabels...)
+		labels = e.buf
+	}
+	sendMetric(e.ch, e.desc, e.valueType, v, labels)
+}
+
+// summaryCollector is a prometheus.Collector exporting the metrics of a set
+// of /stats/summary responses. Samples are built as const metrics when the
+// registry collects, so a scrape allocates the samples it serves and nothing
+// else: no metric vectors, and no per-request registration of them.
+type summaryCollector struct {
+	summaries []*stats.Summary
+
+	// userDefinedMetrics is the allowlist of container user-defined metric
+	// names to export. Their names and values are chosen by workloads, so
+	// nothing is exported unless explicitly allowed.
+	userDefinedMetrics map[string]bool
+
+	// now is the time sample ages are measured against.
+	now time.Time
+}
+
+// newSummaryCollector returns a collector for summaries.
+func newSummaryCollector(summaries []*stats.Summary, userDefinedMetrics map[string]bool) *summaryCollector {
+	return &summaryCollector{
+		summaries:          summaries,
+		userDefinedMetrics: userDefinedMetrics,
+		now:                time.Now(),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *summaryCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, s := range summaryMetricSets {
+		s.describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *summaryCollector) Collect(ch chan<- prometheus.Metric) {
+	e := &emitter{ch: ch, userDefinedMetrics: c.userDefinedMetrics, now: c.now}
+	for _, summary := range c.summaries {
+		collectSummary(e, summary)
+	}
+}
+
+// collectSummary sends the metrics of a single /stats/summary response,
+// walking it once and collecting each level's metricSet with that level's
+// label values.
+func collectSummary(e *emitter, summary *stats.Summary) {
+	nodeName := summary.Node.NodeName
+
+	for i := range summary.Pods {
+		pod := &summary.Pods[i]
+		podLabels := []string{nodeName, pod.PodRef.Name, pod.PodRef.UID, pod.PodRef.Namespace}
+		podMetrics.collect(e, pod, podLabels)
+
+		for j := range pod.Containers {
+			container := &pod.Containers[j]
+			containerLabels := []string{nodeName, pod.PodRef.Name, pod.PodRef.UID, pod.PodRef.Namespace, container.Name}
+			containerMetrics.collect(e, container, containerLabels)
+		}
+
+		for j := range pod.VolumeStats {
+			volume := &pod.VolumeStats[j]
+			pvcName, pvcNamespace := "", ""
+			if volume.PVCRef != nil {
+				pvcName = volume.PVCRef.Name
+				pvcNamespace = volume.PVCRef.Namespace
+			}
+			volumeLabels := []string{nodeName, pod.PodRef.Name, pod.PodRef.UID, pod.PodRef.Namespace, volume.Name, pvcName, pvcNamespace}
+			volumeMetrics.collect(e, volume, volumeLabels)
+		}
+	}
+
+	nodeMetrics.collect(e, &summary.Node, []string{nodeName})
+
+	// System containers are the kubelet, container runtime, pods and misc
+	// cgroups; their names are a small fixed set, so they are safe to use as
+	// a label value.
+	for i := range summary.Node.SystemContainers {
+		sc := &summary.Node.SystemContainers[i]
+		systemContainerMetrics.collect(e, sc, []string{nodeName, sc.Name})
+	}
+}
+
+// sendMetric sends a const metric. Label values come from the kubelet, so a
+// value that fails validation (e.g. invalid UTF-8) is sent as an invalid
+// metric: promhttp logs it and, with ContinueOnError, still serves the rest
+// of the scrape rather than Collect panicking in a registry goroutine.
+func sendMetric(ch chan<- prometheus.Metric, desc *prometheus.Desc, typ prometheus.ValueType, v float64, labels []string) {
+	m, err := prometheus.NewConstMetric(desc, typ, v, labels...)
+	if err != nil {
+		m = prometheus.NewInvalidMetric(desc, err)
+	}
+	ch <- m
+}
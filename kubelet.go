@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+// kubeletClient fetches summaries directly from each node's kubelet rather
+// than through the apiserver's node proxy, so that apiserver load does not
+// scale with the number of nodes scraped.
+type kubeletClient struct {
+	httpClient *http.Client
+
+	// summaryURL returns the URL of /stats/summary on a node's kubelet.
+	summaryURL func(node string) (string, error)
+}
+
+// newKubeletClient returns a kubeletClient authenticating to kubelets with
+// the credentials of config, normally the service account token. Kubelet
+// serving certificates are verified against the CA bundle in caFile, or the
+// CA of config if caFile is empty.
+func newKubeletClient(config *rest.Config, caFile string, summaryURL func(node string) (string, error)) (*kubeletClient, error) {
+	config = rest.CopyConfig(config)
+	if caFile != "" {
+		config.TLSClientConfig.CAFile = caFile
+		config.TLSClientConfig.CAData = nil
+	}
+	// A server name set for the apiserver does not apply to kubelets.
+	config.TLSClientConfig.ServerName = ""
+
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubelet HTTP client: %w", err)
+	}
+	return &kubeletClient{
+		httpClient: httpClient,
+		summaryURL: summaryURL,
+	}, nil
+}
+
+// nodeSummary retrieves the summary for a single node from its kubelet
+func (c *kubeletClient) nodeSummary(ctx context.Context, nodeName string) (*stats.Summary, error) {
+	u, err := c.summaryURL(nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error querying /stats/summary for %s: %w", nodeName, err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying /stats/summary for %s: %w", nodeName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("error querying /stats/summary for %s: %s: %s", nodeName, resp.Status, body)
+	}
+
+	summary := &stats.Summary{}
+	if err := json.NewDecoder(resp.Body).Decode(summary); err != nil {
+		return nil, fmt.Errorf("error unmarshaling /stats/summary response for %s: %w", nodeName, err)
+	}
+
+	return summary, nil
+}
+
+// nodeKubeletURL returns a kubeletClient.summaryURL looking nodes up in
+// nodeLister and connecting to the first of their addresses of addressTypes.
+func nodeKubeletURL(nodeLister listersv1.NodeLister, addressTypes []corev1.NodeAddressType) func(string) (string, error) {
+	return func(nodeName string) (string, error) {
+		node, err := nodeLister.Get(nodeName)
+		if err != nil {
+			return "", fmt.Errorf("error getting node %s: %w", nodeName, err)
+		}
+		return kubeletURL(node, addressTypes)
+	}
+}
+
+// localKubeletURL returns a kubeletClient.summaryURL for node-local mode,
+// which only knows the local node's kubelet, at host and port.
+func localKubeletURL(localNode, host string, port int) func(string) (string, error) {
+	u := kubeletSummaryURL(host, port)
+	return func(nodeName string) (string, error) {
+		if nodeName != localNode {
+			return "", fmt.Errorf("node %s is not the local node %s", nodeName, localNode)
+		}
+		return u, nil
+	}
+}
+
+// kubeletURL returns the URL of /stats/summary on node's kubelet, at the
+// first of the node's addresses of addressTypes and the port its kubelet
+// reports in DaemonEndpoints.
+func kubeletURL(node *corev1.Node, addressTypes []corev1.NodeAddressType) (string, error) {
+	port := node.Status.DaemonEndpoints.KubeletEndpoint.Port
+	if port == 0 {
+		return "", fmt.Errorf("node %s reports no kubelet port", node.Name)
+	}
+	for _, typ := range addressTypes {
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == typ && addr.Address != "" {
+				return kubeletSummaryURL(addr.Address, int(port)), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("node %s has no address of types %v", node.Name, addressTypes)
+}
+
+// kubeletSummaryURL returns the URL of /stats/summary on the kubelet at host and
+// port.
+func kubeletSummaryURL(host string, port int) string {
+	u := url.URL{
+		Scheme: "https",
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   "/stats/summary",
+	}
+	return u.String()
+}
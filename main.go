@@ -6,10 +6,12 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -17,8 +19,10 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
 
@@ -29,9 +33,23 @@ import (
 const defaultScrapeTimeout = 60 * time.Second
 
 var (
-	flagKubeConfigPath = flag.String("kubeconfig", "", "Path of a kubeconfig file, if not provided the app will try $KUBECONFIG, $HOME/.kube/config or in cluster config")
-	flagListenAddress  = flag.String("listen-address", ":9779", "Listen address")
-	metricsNamespace   = "kube_summary"
+	flagKubeConfigPath      = flag.String("kubeconfig", "", "Path of a kubeconfig file, if not provided the app will try $KUBECONFIG, $HOME/.kube/config or in cluster config")
+	flagListenAddress       = flag.String("listen-address", ":9779", "Listen address")
+	flagNodeLocal           = flag.Bool("node-local", false, "Scrape only the local node, named by the NODE_NAME environment variable, directly from its kubelet at NODE_IP, as when running as a DaemonSet")
+	flagKubeletPort         = flag.Int("kubelet-port", 10250, "Port of the local kubelet with --node-local")
+	flagKubeletTransport    = flag.String("kubelet-transport", "proxy", "How to reach kubelets: proxy through the apiserver, or direct to each node's kubelet")
+	flagKubeletCAFile       = flag.String("kubelet-ca-file", "", "Path of a CA bundle verifying kubelet serving certificates with --kubelet-transport=direct, if not provided the kube client's CA is used")
+	flagKubeletAddressTypes = flag.String("kubelet-address-types", "InternalIP,ExternalIP,Hostname", "Comma-separated node address types to connect to with --kubelet-transport=direct, in order of preference")
+	flagShardCount          = flag.Int("shard-count", 1, "Number of exporter replicas /nodes is split across; each node is served by exactly one")
+	flagShardIndex          = flag.Int("shard-index", -1, "Index of this replica's shard, from 0 to --shard-count - 1, if negative it is the StatefulSet ordinal at the end of the hostname")
+	flagSkipUnreadyNodes    = flag.Bool("skip-unready-nodes", false, "Skip nodes that are NotReady or tainted unreachable in /nodes scrapes and the background poll, reporting them in kube_summary_exporter_node_skipped instead")
+	flagMaxConcurrency      = flag.Int("max-concurrency", 0, "Maximum number of node /stats/summary requests in flight at once, across all scrapes and the background poll, if 0 there is no limit")
+	flagScrapeSpread        = flag.Duration("scrape-spread", 0, "Window over which the start of each node's /stats/summary request in a /nodes scrape or background poll is randomly spread")
+	flagStaleSummaryWindow  = flag.Duration("stale-summary-window", 0, "How long to keep serving a node's last successful /stats/summary while its scrapes fail, if 0 a failed node's metrics disappear until it recovers")
+	flagPollInterval        = flag.Duration("poll-interval", 0, "Interval at which to poll every node's /stats/summary in the background and serve /nodes and /node/{node} from the latest poll, if 0 nodes are scraped on every request")
+	flagPollTimeout         = flag.Duration("poll-timeout", 0, "Timeout of each node's /stats/summary request in the background poll, shorter than --poll-interval, if 0 it is half of --poll-interval")
+	flagUserDefinedMetrics  = flag.String("user-defined-metrics", "", "Comma-separated allowlist of container user-defined metric names to export, none are exported if empty")
+	metricsNamespace        = "kube_summary"
 
 	logHandler = slog.NewTextHandler(os.Stderr, nil)
 
@@ -54,6 +72,21 @@ func init() {
 type scrapeMetrics struct {
 	success  *prometheus.GaugeVec
 	duration *prometheus.GaugeVec
+
+	// queueWait is only set when scrape slots are limited.
+	queueWait *prometheus.GaugeVec
+
+	// cacheAge is only set when serving from the background poll's cache.
+	cacheAge *prometheus.GaugeVec
+
+	// ownedNode is only set when nodes are sharded across replicas.
+	ownedNode *prometheus.GaugeVec
+
+	// skipped is only set for unready nodes left out of /nodes.
+	skipped *prometheus.GaugeVec
+
+	// summaryAge is set for every node whose summary is served.
+	summaryAge *prometheus.GaugeVec
 }
 
 // newScrapeMetrics builds the scrape gauges and registers them on registry.
@@ -71,8 +104,38 @@ func newScrapeMetrics(registry *prometheus.Registry) scrapeMetrics {
 			Name:      "last_scrape_duration_seconds",
 			Help:      "Duration of the last scrape of a node's /stats/summary in seconds",
 		}, []string{"node"}),
+		queueWait: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "exporter",
+			Name:      "last_scrape_queue_wait_seconds",
+			Help:      "Time the last scrape of a node's /stats/summary waited for a free scrape slot, in seconds",
+		}, []string{"node"}),
+		cacheAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "exporter",
+			Name:      "cache_age_seconds",
+			Help:      "Time since the node's cached /stats/summary was fetched by the background poll, in seconds",
+		}, []string{"node"}),
+		ownedNode: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "exporter",
+			Name:      "shard_owned_node",
+			Help:      "Set to 1 for each node owned by the shard serving it; every node should be owned by exactly one shard",
+		}, []string{"node", "shard"}),
+		skipped: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "exporter",
+			Name:      "node_skipped",
+			Help:      "Set to 1 for each node not scraped by /nodes, with the reason it was skipped",
+		}, []string{"node", "reason"}),
+		summaryAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "exporter",
+			Name:      "summary_age_seconds",
+			Help:      "Time since the node's served /stats/summary was fetched, in seconds; it keeps growing while a failed or skipped node's last successful summary is served",
+		}, []string{"node"}),
 	}
-	registry.MustRegister(m.success, m.duration)
+	registry.MustRegister(m.success, m.duration, m.queueWait, m.cacheAge, m.ownedNode, m.skipped, m.summaryAge)
 	return m
 }
 
@@ -93,408 +156,204 @@ var handlerOpts = promhttp.HandlerOpts{
 	ErrorLog:      errorLog,
 }
 
-type Collectors struct {
-	containerLogsInodesFree           *prometheus.GaugeVec
-	containerLogsInodes               *prometheus.GaugeVec
-	containerLogsInodesUsed           *prometheus.GaugeVec
-	containerLogsAvailableBytes       *prometheus.GaugeVec
-	containerLogsCapacityBytes        *prometheus.GaugeVec
-	containerLogsUsedBytes            *prometheus.GaugeVec
-	containerRootFsInodesFree         *prometheus.GaugeVec
-	containerRootFsInodes             *prometheus.GaugeVec
-	containerRootFsInodesUsed         *prometheus.GaugeVec
-	containerRootFsAvailableBytes     *prometheus.GaugeVec
-	containerRootFsCapacityBytes      *prometheus.GaugeVec
-	containerRootFsUsedBytes          *prometheus.GaugeVec
-	podEphemeralStorageAvailableBytes *prometheus.GaugeVec
-	podEphemeralStorageCapacityBytes  *prometheus.GaugeVec
-	podEphemeralStorageUsedBytes      *prometheus.GaugeVec
-	podEphemeralStorageInodesFree     *prometheus.GaugeVec
-	podEphemeralStorageInodes         *prometheus.GaugeVec
-	podEphemeralStorageInodesUsed     *prometheus.GaugeVec
-	podVolumeStorageAvailableBytes    *prometheus.GaugeVec
-	podVolumeStorageCapacityBytes     *prometheus.GaugeVec
-	podVolumeStorageUsedBytes         *prometheus.GaugeVec
-	podVolumeStorageInodesFree        *prometheus.GaugeVec
-	podVolumeStorageInodes            *prometheus.GaugeVec
-	podVolumeStorageInodesUsed        *prometheus.GaugeVec
-	nodeRuntimeImageFSAvailableBytes  *prometheus.GaugeVec
-	nodeRuntimeImageFSCapacityBytes   *prometheus.GaugeVec
-	nodeRuntimeImageFSUsedBytes       *prometheus.GaugeVec
-	nodeRuntimeImageFSInodesFree      *prometheus.GaugeVec
-	nodeRuntimeImageFSInodes          *prometheus.GaugeVec
-	nodeRuntimeImageFSInodesUsed      *prometheus.GaugeVec
-}
+// exporter serves the summary metrics of the cluster's nodes.
+type exporter struct {
+	nodeLister listersv1.NodeLister
 
-func newCollectors() *Collectors {
-	return &Collectors{
-		containerLogsInodesFree: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_logs_inodes_free",
-			Help:      "Number of available Inodes for logs",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerLogsInodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_logs_inodes",
-			Help:      "Number of Inodes for logs",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerLogsInodesUsed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_logs_inodes_used",
-			Help:      "Number of used Inodes for logs",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerLogsAvailableBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_logs_available_bytes",
-			Help:      "Number of bytes that aren't consumed by the container logs",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerLogsCapacityBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_logs_capacity_bytes",
-			Help:      "Number of bytes that can be consumed by the container logs",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerLogsUsedBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_logs_used_bytes",
-			Help:      "Number of bytes that are consumed by the container logs",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerRootFsInodesFree: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_rootfs_inodes_free",
-			Help:      "Number of available Inodes",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerRootFsInodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_rootfs_inodes",
-			Help:      "Number of Inodes",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerRootFsInodesUsed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_rootfs_inodes_used",
-			Help:      "Number of used Inodes",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerRootFsAvailableBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_rootfs_available_bytes",
-			Help:      "Number of bytes that aren't consumed by the container",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerRootFsCapacityBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_rootfs_capacity_bytes",
-			Help:      "Number of bytes that can be consumed by the container",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		containerRootFsUsedBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "container_rootfs_used_bytes",
-			Help:      "Number of bytes that are consumed by the container",
-		}, []string{"node", "pod", "uid", "namespace", "name"}),
-		podEphemeralStorageAvailableBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_ephemeral_storage_available_bytes",
-			Help:      "Number of bytes of Ephemeral storage that aren't consumed by the pod",
-		}, []string{"node", "pod", "uid", "namespace"}),
-		podEphemeralStorageCapacityBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_ephemeral_storage_capacity_bytes",
-			Help:      "Number of bytes of Ephemeral storage that can be consumed by the pod",
-		}, []string{"node", "pod", "uid", "namespace"}),
-		podEphemeralStorageUsedBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_ephemeral_storage_used_bytes",
-			Help:      "Number of bytes of Ephemeral storage that are consumed by the pod",
-		}, []string{"node", "pod", "uid", "namespace"}),
-		podEphemeralStorageInodesFree: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_ephemeral_storage_inodes_free",
-			Help:      "Number of available Inodes for pod Ephemeral storage",
-		}, []string{"node", "pod", "uid", "namespace"}),
-		podEphemeralStorageInodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_ephemeral_storage_inodes",
-			Help:      "Number of Inodes for pod Ephemeral storage",
-		}, []string{"node", "pod", "uid", "namespace"}),
-		podEphemeralStorageInodesUsed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_ephemeral_storage_inodes_used",
-			Help:      "Number of used Inodes for pod Ephemeral storage",
-		}, []string{"node", "pod", "uid", "namespace"}),
-		podVolumeStorageAvailableBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_volume_storage_available_bytes",
-			Help:      "Number of bytes of Volume storage that aren't consumed by the pod",
-		}, []string{"node", "pod", "uid", "namespace", "name", "persistentvolumeclaim", "pvc_namespace"}),
-		podVolumeStorageCapacityBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_volume_storage_capacity_bytes",
-			Help:      "Number of bytes of Volume storage that can be consumed by the pod",
-		}, []string{"node", "pod", "uid", "namespace", "name", "persistentvolumeclaim", "pvc_namespace"}),
-		podVolumeStorageUsedBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_volume_storage_used_bytes",
-			Help:      "Number of bytes of Volume storage that are consumed by the pod",
-		}, []string{"node", "pod", "uid", "namespace", "name", "persistentvolumeclaim", "pvc_namespace"}),
-		podVolumeStorageInodesFree: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_volume_storage_inodes_free",
-			Help:      "Number of available Inodes for pod Volume storage",
-		}, []string{"node", "pod", "uid", "namespace", "name", "persistentvolumeclaim", "pvc_namespace"}),
-		podVolumeStorageInodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_volume_storage_inodes",
-			Help:      "Number of Inodes for pod Volume storage",
-		}, []string{"node", "pod", "uid", "namespace", "name", "persistentvolumeclaim", "pvc_namespace"}),
-		podVolumeStorageInodesUsed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "pod_volume_storage_inodes_used",
-			Help:      "Number of used Inodes for pod Volume storage",
-		}, []string{"node", "pod", "uid", "namespace", "name", "persistentvolumeclaim", "pvc_namespace"}),
-		nodeRuntimeImageFSAvailableBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "node_runtime_imagefs_available_bytes",
-			Help:      "Number of bytes of node Runtime ImageFS that aren't consumed",
-		}, []string{"node"}),
-		nodeRuntimeImageFSCapacityBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "node_runtime_imagefs_capacity_bytes",
-			Help:      "Number of bytes of node Runtime ImageFS that can be consumed",
-		}, []string{"node"}),
-		nodeRuntimeImageFSUsedBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "node_runtime_imagefs_used_bytes",
-			Help:      "Number of bytes of node Runtime ImageFS that are consumed",
-		}, []string{"node"}),
-		nodeRuntimeImageFSInodesFree: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "node_runtime_imagefs_inodes_free",
-			Help:      "Number of available Inodes for node Runtime ImageFS",
-		}, []string{"node"}),
-		nodeRuntimeImageFSInodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "node_runtime_imagefs_inodes",
-			Help:      "Number of Inodes for node Runtime ImageFS",
-		}, []string{"node"}),
-		nodeRuntimeImageFSInodesUsed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: metricsNamespace,
-			Name:      "node_runtime_imagefs_inodes_used",
-			Help:      "Number of used Inodes for node Runtime ImageFS",
-		}, []string{"node"}),
-	}
-}
+	// localNode is the only node scraped in node-local mode, in which case
+	// nodeLister is nil.
+	localNode string
 
-func (c *Collectors) register(registry *prometheus.Registry) {
-	registry.MustRegister(
-		c.containerLogsInodesFree,
-		c.containerLogsInodes,
-		c.containerLogsInodesUsed,
-		c.containerLogsAvailableBytes,
-		c.containerLogsCapacityBytes,
-		c.containerLogsUsedBytes,
-		c.containerRootFsInodesFree,
-		c.containerRootFsInodes,
-		c.containerRootFsInodesUsed,
-		c.containerRootFsAvailableBytes,
-		c.containerRootFsCapacityBytes,
-		c.containerRootFsUsedBytes,
-		c.podEphemeralStorageAvailableBytes,
-		c.podEphemeralStorageCapacityBytes,
-		c.podEphemeralStorageUsedBytes,
-		c.podEphemeralStorageInodesFree,
-		c.podEphemeralStorageInodes,
-		c.podEphemeralStorageInodesUsed,
-		c.podVolumeStorageAvailableBytes,
-		c.podVolumeStorageCapacityBytes,
-		c.podVolumeStorageUsedBytes,
-		c.podVolumeStorageInodesFree,
-		c.podVolumeStorageInodes,
-		c.podVolumeStorageInodesUsed,
-		c.nodeRuntimeImageFSAvailableBytes,
-		c.nodeRuntimeImageFSCapacityBytes,
-		c.nodeRuntimeImageFSUsedBytes,
-		c.nodeRuntimeImageFSInodesFree,
-		c.nodeRuntimeImageFSInodes,
-		c.nodeRuntimeImageFSInodesUsed,
-	)
-}
+	// shard is the subset of nodes this replica serves.
+	shard shard
 
-// fsCollectors groups the six GaugeVecs that mirror the fields of a
-// stats.FsStats, in the order availableBytes, capacityBytes, usedBytes,
-// inodesFree, inodes, inodesUsed.
-type fsCollectors struct {
-	availableBytes *prometheus.GaugeVec
-	capacityBytes  *prometheus.GaugeVec
-	usedBytes      *prometheus.GaugeVec
-	inodesFree     *prometheus.GaugeVec
-	inodes         *prometheus.GaugeVec
-	inodesUsed     *prometheus.GaugeVec
-}
+	// skipUnready skips unready nodes in /nodes rather than waiting on
+	// their kubelets.
+	skipUnready bool
 
-// collectFsStats sets all six collectors from a single FsStats using the same
-// label values for every series. Nil fields are skipped.
-func collectFsStats(fs *stats.FsStats, c fsCollectors, labels []string) {
-	setGauge(c.availableBytes, labels, fs.AvailableBytes)
-	setGauge(c.capacityBytes, labels, fs.CapacityBytes)
-	setGauge(c.usedBytes, labels, fs.UsedBytes)
-	setGauge(c.inodesFree, labels, fs.InodesFree)
-	setGauge(c.inodes, labels, fs.Inodes)
-	setGauge(c.inodesUsed, labels, fs.InodesUsed)
-}
+	// lastGood holds the last successful scrape of every node, served in
+	// place of failed scrapes. It is nil unless a staleness window is set.
+	lastGood *lastGoodCache
 
-// setGauge sets vec for the given labels to v if v is non-nil.
-func setGauge(vec *prometheus.GaugeVec, labels []string, v *uint64) {
-	if v != nil {
-		vec.WithLabelValues(labels...).Set(float64(*v))
-	}
+	// fetch retrieves the summary of a node.
+	fetch func(ctx context.Context, node string) (*stats.Summary, error)
+
+	// fetchTimeout bounds each fetch, if set. It is set for background
+	// polling, so a hung kubelet gives up well before the next poll.
+	fetchTimeout time.Duration
+
+	// scrapeSlots bounds the number of fetches in flight across all
+	// requests and the background poll; a fetch holds a slot by sending to
+	// it. It is nil when concurrency is unlimited.
+	scrapeSlots chan struct{}
+
+	// scrapeSpread is the window over which scrapeNodes randomly spreads
+	// the start of its fetches.
+	scrapeSpread time.Duration
+
+	// userDefinedMetrics is the allowlist of container user-defined metric
+	// names passed to every summaryCollector.
+	userDefinedMetrics map[string]bool
+
+	// cache holds the scrapes made by poll. It is nil unless background
+	// polling is enabled, in which case the handlers serve from it rather
+	// than scraping nodes themselves.
+	cache *summaryCache
 }
 
-// collectSummaryMetrics collects metrics from a /stats/summary response
-func collectSummaryMetrics(summary *stats.Summary, collectors *Collectors) {
-	nodeName := summary.Node.NodeName
-
-	logsCs := fsCollectors{
-		availableBytes: collectors.containerLogsAvailableBytes,
-		capacityBytes:  collectors.containerLogsCapacityBytes,
-		usedBytes:      collectors.containerLogsUsedBytes,
-		inodesFree:     collectors.containerLogsInodesFree,
-		inodes:         collectors.containerLogsInodes,
-		inodesUsed:     collectors.containerLogsInodesUsed,
-	}
-	rootfsCs := fsCollectors{
-		availableBytes: collectors.containerRootFsAvailableBytes,
-		capacityBytes:  collectors.containerRootFsCapacityBytes,
-		usedBytes:      collectors.containerRootFsUsedBytes,
-		inodesFree:     collectors.containerRootFsInodesFree,
-		inodes:         collectors.containerRootFsInodes,
-		inodesUsed:     collectors.containerRootFsInodesUsed,
-	}
-	ephemeralCs := fsCollectors{
-		availableBytes: collectors.podEphemeralStorageAvailableBytes,
-		capacityBytes:  collectors.podEphemeralStorageCapacityBytes,
-		usedBytes:      collectors.podEphemeralStorageUsedBytes,
-		inodesFree:     collectors.podEphemeralStorageInodesFree,
-		inodes:         collectors.podEphemeralStorageInodes,
-		inodesUsed:     collectors.podEphemeralStorageInodesUsed,
-	}
-	volumeCs := fsCollectors{
-		availableBytes: collectors.podVolumeStorageAvailableBytes,
-		capacityBytes:  collectors.podVolumeStorageCapacityBytes,
-		usedBytes:      collectors.podVolumeStorageUsedBytes,
-		inodesFree:     collectors.podVolumeStorageInodesFree,
-		inodes:         collectors.podVolumeStorageInodes,
-		inodesUsed:     collectors.podVolumeStorageInodesUsed,
-	}
-	imageFsCs := fsCollectors{
-		availableBytes: collectors.nodeRuntimeImageFSAvailableBytes,
-		capacityBytes:  collectors.nodeRuntimeImageFSCapacityBytes,
-		usedBytes:      collectors.nodeRuntimeImageFSUsedBytes,
-		inodesFree:     collectors.nodeRuntimeImageFSInodesFree,
-		inodes:         collectors.nodeRuntimeImageFSInodes,
-		inodesUsed:     collectors.nodeRuntimeImageFSInodesUsed,
-	}
-
-	nodeLabels := []string{nodeName}
-
-	for _, pod := range summary.Pods {
-		podLabels := []string{nodeName, pod.PodRef.Name, pod.PodRef.UID, pod.PodRef.Namespace}
-
-		for _, container := range pod.Containers {
-			containerLabels := []string{nodeName, pod.PodRef.Name, pod.PodRef.UID, pod.PodRef.Namespace, container.Name}
-			if container.Logs != nil {
-				collectFsStats(container.Logs, logsCs, containerLabels)
-			}
-			if container.Rootfs != nil {
-				collectFsStats(container.Rootfs, rootfsCs, containerLabels)
-			}
-		}
+// nodeScrape is the outcome of fetching a single node's /stats/summary.
+type nodeScrape struct {
+	node     string
+	summary  *stats.Summary
+	err      error
+	duration time.Duration
 
-		if pod.EphemeralStorage != nil {
-			collectFsStats(pod.EphemeralStorage, ephemeralCs, podLabels)
-		}
+	// queueWait is how long the scrape waited for a scrape slot.
+	queueWait time.Duration
 
-		for _, volume := range pod.VolumeStats {
-			pvcName, pvcNamespace := "", ""
-			if volume.PVCRef != nil {
-				pvcName = volume.PVCRef.Name
-				pvcNamespace = volume.PVCRef.Namespace
-			}
-			volumeLabels := []string{nodeName, pod.PodRef.Name, pod.PodRef.UID, pod.PodRef.Namespace, volume.Name, pvcName, pvcNamespace}
-			collectFsStats(&volume.FsStats, volumeCs, volumeLabels)
-		}
-	}
+	// skipped is why the node was not scraped at all, if it wasn't.
+	skipped string
 
-	if runtime := summary.Node.Runtime; runtime != nil && runtime.ImageFs != nil {
-		collectFsStats(runtime.ImageFs, imageFsCs, nodeLabels)
-	}
+	// fetched is when summary was fetched. It is earlier than time when a
+	// failed scrape is served with the node's last successful summary.
+	fetched time.Time
+
+	// time is when the scrape finished.
+	time time.Time
 }
 
 // nodeHandler returns metrics for the /stats/summary API of the given node
-func nodeHandler(w http.ResponseWriter, r *http.Request, kubeClient *kubernetes.Clientset) {
+func (e *exporter) nodeHandler(w http.ResponseWriter, r *http.Request) {
 	node := mux.Vars(r)["node"]
 
-	ctx, cancel := timeoutContext(r)
-	defer cancel()
-
-	collectors := newCollectors()
-	registry := prometheus.NewRegistry()
-	collectors.register(registry)
-	scrape := newScrapeMetrics(registry)
+	if e.localNode != "" && node != e.localNode {
+		http.Error(w, fmt.Sprintf("Node %s is not the local node %s", node, e.localNode), http.StatusNotFound)
+		return
+	}
+	if !e.shard.owns(node) {
+		http.Error(w, fmt.Sprintf("Node %s is not owned by shard %d of %d", node, e.shard.index, e.shard.count), http.StatusNotFound)
+		return
+	}
 
-	start := time.Now()
-	summary, err := nodeSummary(ctx, kubeClient, node)
-	scrape.observe(node, time.Since(start), err)
-	if err != nil {
-		// Serve the registry with scrape_success=0 rather than failing the
-		// HTTP request, so the failure signal reaches Prometheus (a 500 would
-		// drop every metric, including scrape_success).
-		slog.Error("scrape node", "node", node, "err", err)
-	} else {
-		collectSummaryMetrics(summary, collectors)
+	if e.cache != nil {
+		s, ok := e.cache.get(node)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Node %s not found in cache", node), http.StatusNotFound)
+			return
+		}
+		e.serve(w, r, []nodeScrape{s})
+		return
 	}
 
-	h := promhttp.HandlerFor(registry, handlerOpts)
-	h.ServeHTTP(w, r)
+	ctx, cancel := timeoutContext(r)
+	defer cancel()
+
+	e.serve(w, r, []nodeScrape{e.scrapeNode(ctx, node)})
 }
 
 // allNodesHandler returns metrics for all nodes in the cluster
-func allNodesHandler(w http.ResponseWriter, r *http.Request, kubeClient *kubernetes.Clientset) {
-	ctx, cancel := timeoutContext(r)
-	defer cancel()
+func (e *exporter) allNodesHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseNodeFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid node filter: %v", err), http.StatusBadRequest)
+		return
+	}
+	// The local node is not looked up, so there are no labels or fields to
+	// select on.
+	if e.localNode != "" && (filter.labels != nil || filter.fields != nil) {
+		http.Error(w, "Invalid node filter: label and field selectors are not supported in node-local mode", http.StatusBadRequest)
+		return
+	}
 
-	nodes, err := kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	nodes, skipped, err := e.listNodes(filter)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error listing nodes: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	collectors := newCollectors()
+	if e.cache != nil {
+		e.serve(w, r, append(e.cache.list(nodes), skipped...))
+		return
+	}
+
+	ctx, cancel := timeoutContext(r)
+	defer cancel()
+
+	e.serve(w, r, append(e.scrapeNodes(ctx, nodes), skipped...))
+}
+
+// serve responds with the summary metrics of the scrapes carrying a summary,
+// including failed and skipped ones served from the node's last successful
+// summary, and the scrape metrics of all of them, or the reason for skipped
+// ones. Failed scrapes are served with scrape_success=0 rather than failing
+// the HTTP request, so the failure signal reaches Prometheus (a 500 would
+// drop every metric, including scrape_success).
+func (e *exporter) serve(w http.ResponseWriter, r *http.Request, scrapes []nodeScrape) {
 	registry := prometheus.NewRegistry()
-	collectors.register(registry)
 	scrape := newScrapeMetrics(registry)
 
-	type result struct {
-		summary  *stats.Summary
-		node     string
-		err      error
-		duration time.Duration
+	now := time.Now()
+	summaries := make([]*stats.Summary, 0, len(scrapes))
+	for _, s := range scrapes {
+		if e.shard.enabled() {
+			scrape.ownedNode.WithLabelValues(s.node, strconv.Itoa(e.shard.index)).Set(1)
+		}
+		if s.skipped != "" {
+			scrape.skipped.WithLabelValues(s.node, s.skipped).Set(1)
+		} else {
+			scrape.observe(s.node, s.duration, s.err)
+			if e.scrapeSlots != nil {
+				scrape.queueWait.WithLabelValues(s.node).Set(s.queueWait.Seconds())
+			}
+			if e.cache != nil {
+				scrape.cacheAge.WithLabelValues(s.node).Set(now.Sub(s.time).Seconds())
+			}
+		}
+		if s.summary != nil {
+			summaries = append(summaries, s.summary)
+			scrape.summaryAge.WithLabelValues(s.node).Set(now.Sub(s.fetched).Seconds())
+		}
+	}
+	registry.MustRegister(newSummaryCollector(summaries, e.userDefinedMetrics))
+
+	h := promhttp.HandlerFor(registry, handlerOpts)
+	h.ServeHTTP(w, r)
+}
+
+// scrapeNodes fetches the summaries of nodes concurrently, starting each
+// fetch at a random offset within e.scrapeSpread. A node that fails is
+// recorded in its nodeScrape and does not fail the others.
+func (e *exporter) scrapeNodes(ctx context.Context, nodes []string) []nodeScrape {
+	scrapes := make([]nodeScrape, 0, len(nodes))
+	for s := range e.streamNodes(ctx, nodes) {
+		scrapes = append(scrapes, s)
 	}
+	return scrapes
+}
 
-	results := make(chan result, len(nodes.Items))
+// streamNodes is scrapeNodes sending each node's scrape as soon as it
+// finishes. The channel is closed once every node has been scraped.
+func (e *exporter) streamNodes(ctx context.Context, nodes []string) <-chan nodeScrape {
+	results := make(chan nodeScrape, len(nodes))
 	var wg sync.WaitGroup
 
-	// Process each node concurrently
-	for _, node := range nodes.Items {
+	// Process each node concurrently, within the limit of scrapeSlots
+	for _, node := range nodes {
 		wg.Add(1)
 		go func(n string) {
 			defer wg.Done()
-
-			start := time.Now()
-			summary, err := nodeSummary(ctx, kubeClient, n)
-			results <- result{
-				summary:  summary,
-				node:     n,
-				err:      err,
-				duration: time.Since(start),
+			if e.scrapeSpread > 0 {
+				t := time.NewTimer(rand.N(e.scrapeSpread))
+				defer t.Stop()
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					results <- e.withLastGood(failedScrape(n, fmt.Errorf("waiting to scrape %s: %w", n, ctx.Err())))
+					return
+				}
 			}
-		}(node.Name)
+			results <- e.scrapeNode(ctx, n)
+		}(node)
 	}
 
 	// Close channel when all node scrapes finish
@@ -503,20 +362,69 @@ func allNodesHandler(w http.ResponseWriter, r *http.Request, kubeClient *kuberne
 		close(results)
 	}()
 
-	// Consume results
-	for res := range results {
-		scrape.observe(res.node, res.duration, res.err)
-		if res.err != nil {
-			// Record the failure and DO NOT fail the whole scrape
-			slog.Error("scrape node", "node", res.node, "err", res.err)
-			continue
+	return results
+}
+
+// scrapeNode fetches the summary of a single node once a scrape slot is
+// free, logging any failure. A failed scrape carries the node's last
+// successful summary if it is recent enough.
+func (e *exporter) scrapeNode(ctx context.Context, node string) nodeScrape {
+	return e.withLastGood(e.fetchNode(ctx, node))
+}
+
+// withLastGood records s as the node's last successful scrape if it
+// succeeded, or returns it with the node's last successful summary if it
+// failed within the staleness window of that.
+func (e *exporter) withLastGood(s nodeScrape) nodeScrape {
+	if e.lastGood == nil {
+		return s
+	}
+	return e.lastGood.resolve(s)
+}
+
+// fetchNode fetches the summary of a single node once a scrape slot is free,
+// logging any failure.
+func (e *exporter) fetchNode(ctx context.Context, node string) nodeScrape {
+	queued := time.Now()
+	if e.scrapeSlots != nil {
+		select {
+		case e.scrapeSlots <- struct{}{}:
+			defer func() { <-e.scrapeSlots }()
+		case <-ctx.Done():
+			s := failedScrape(node, fmt.Errorf("waiting for a scrape slot for %s: %w", node, ctx.Err()))
+			s.queueWait = s.time.Sub(queued)
+			return s
 		}
-		collectSummaryMetrics(res.summary, collectors)
 	}
 
-	// Return all aggregated metrics
-	h := promhttp.HandlerFor(registry, handlerOpts)
-	h.ServeHTTP(w, r)
+	if e.fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.fetchTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	summary, err := e.fetch(ctx, node)
+	end := time.Now()
+	if err != nil {
+		slog.Error("scrape node", "node", node, "err", err)
+	}
+	return nodeScrape{
+		node:      node,
+		summary:   summary,
+		err:       err,
+		duration:  end.Sub(start),
+		queueWait: start.Sub(queued),
+		time:      end,
+		fetched:   end,
+	}
+}
+
+// failedScrape logs and returns the scrape of a node that failed before its
+// summary was requested.
+func failedScrape(node string, err error) nodeScrape {
+	slog.Error("scrape node", "node", node, "err", err)
+	return nodeScrape{node: node, err: err, time: time.Now()}
 }
 
 // nodeSummary retrieves the summary for a single node
@@ -548,11 +456,23 @@ func timeoutContext(r *http.Request) (context.Context, context.CancelFunc) {
 	return context.WithTimeout(r.Context(), defaultScrapeTimeout)
 }
 
-// newKubeClient returns a Kubernetes client (clientset) with configurable
-// rate limits from a supplied kubeconfig path, the KUBECONFIG environment variable,
+// splitList splits a comma-separated flag value into its non-empty,
+// whitespace-trimmed elements.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// newKubeConfig returns a Kubernetes client config with configurable rate
+// limits from a supplied kubeconfig path, the KUBECONFIG environment variable,
 // the default config file location ($HOME/.kube/config), or from the in-cluster
 // service account environment.
-func newKubeClient(path string) (*kubernetes.Clientset, error) {
+func newKubeConfig(path string) (*rest.Config, error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	if path != "" {
 		loadingRules.ExplicitPath = path
@@ -572,25 +492,123 @@ func newKubeClient(path string) (*kubernetes.Clientset, error) {
 	config.QPS = 100
 	config.Burst = 200
 
-	return kubernetes.NewForConfig(config)
+	return config, nil
+}
+
+// newExporter returns an exporter configured by the command-line flags,
+// starting the node informer it needs until ctx is done.
+func newExporter(ctx context.Context, kubeConfig *rest.Config) (*exporter, error) {
+	e := &exporter{
+		skipUnready:        *flagSkipUnreadyNodes,
+		scrapeSpread:       *flagScrapeSpread,
+		userDefinedMetrics: make(map[string]bool),
+	}
+	for _, name := range splitList(*flagUserDefinedMetrics) {
+		e.userDefinedMetrics[name] = true
+	}
+	if *flagMaxConcurrency > 0 {
+		e.scrapeSlots = make(chan struct{}, *flagMaxConcurrency)
+	}
+	if *flagStaleSummaryWindow > 0 {
+		e.lastGood = newLastGoodCache(*flagStaleSummaryWindow)
+	}
+
+	if *flagShardCount > 1 {
+		if *flagNodeLocal {
+			return nil, fmt.Errorf("sharding does not apply to node-local mode")
+		}
+		e.shard = shard{index: *flagShardIndex, count: *flagShardCount}
+		if e.shard.index < 0 {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return nil, fmt.Errorf("error getting hostname for the shard index: %w", err)
+			}
+			if e.shard.index, err = hostnameOrdinal(hostname); err != nil {
+				return nil, err
+			}
+		}
+		if e.shard.index >= e.shard.count {
+			return nil, fmt.Errorf("shard index %d out of range for %d shards", e.shard.index, e.shard.count)
+		}
+	}
+
+	// In node-local mode the exporter only talks to its own node's kubelet,
+	// so it needs neither the node informer nor the apiserver proxy.
+	if *flagNodeLocal {
+		e.localNode = os.Getenv("NODE_NAME")
+		nodeIP := os.Getenv("NODE_IP")
+		if e.localNode == "" || nodeIP == "" {
+			return nil, fmt.Errorf("node-local mode requires the NODE_NAME and NODE_IP environment variables")
+		}
+		kc, err := newKubeletClient(kubeConfig, *flagKubeletCAFile, localKubeletURL(e.localNode, nodeIP, *flagKubeletPort))
+		if err != nil {
+			return nil, err
+		}
+		e.fetch = kc.nodeSummary
+		return e, nil
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kube client: %w", err)
+	}
+	e.nodeLister, err = newNodeLister(ctx, kubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	switch *flagKubeletTransport {
+	case "proxy":
+		e.fetch = func(ctx context.Context, node string) (*stats.Summary, error) {
+			return nodeSummary(ctx, kubeClient, node)
+		}
+	case "direct":
+		var addressTypes []corev1.NodeAddressType
+		for _, typ := range splitList(*flagKubeletAddressTypes) {
+			addressTypes = append(addressTypes, corev1.NodeAddressType(typ))
+		}
+		kc, err := newKubeletClient(kubeConfig, *flagKubeletCAFile, nodeKubeletURL(e.nodeLister, addressTypes))
+		if err != nil {
+			return nil, err
+		}
+		e.fetch = kc.nodeSummary
+	default:
+		return nil, fmt.Errorf("unknown kubelet transport %q, want proxy or direct", *flagKubeletTransport)
+	}
+	return e, nil
 }
 
 func main() {
 	flag.Parse()
 
-	kubeClient, err := newKubeClient(*flagKubeConfigPath)
+	kubeConfig, err := newKubeConfig(*flagKubeConfigPath)
+	if err != nil {
+		slog.Error("load kube config", "err", err)
+		os.Exit(1)
+	}
+
+	// ctx stops background work (the node informer and poll) on shutdown.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	e, err := newExporter(ctx, kubeConfig)
 	if err != nil {
-		slog.Error("create kube client", "err", err)
+		slog.Error("create exporter", "err", err)
 		os.Exit(1)
 	}
 
+	if *flagPollInterval > 0 {
+		e.cache = newSummaryCache()
+		e.fetchTimeout = *flagPollTimeout
+		if e.fetchTimeout <= 0 || e.fetchTimeout >= *flagPollInterval {
+			e.fetchTimeout = *flagPollInterval / 2
+		}
+		go e.poll(ctx, *flagPollInterval)
+	}
+
 	r := mux.NewRouter()
-	r.HandleFunc("/nodes", func(w http.ResponseWriter, r *http.Request) {
-		allNodesHandler(w, r, kubeClient)
-	})
-	r.HandleFunc("/node/{node}", func(w http.ResponseWriter, r *http.Request) {
-		nodeHandler(w, r, kubeClient)
-	})
+	r.HandleFunc("/nodes", e.allNodesHandler)
+	r.HandleFunc("/node/{node}", e.nodeHandler)
 	r.Handle("/metrics", promhttp.Handler())
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte(`<html>
@@ -623,6 +641,7 @@ func main() {
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		sig := <-sigCh
 		slog.Info("received signal, shutting down", "signal", sig)
+		stop()
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		if err := srv.Shutdown(shutdownCtx); err != nil {
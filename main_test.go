@@ -1,23 +1,48 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
 )
 
+// bootTime is the fixture's node start time; pods and containers start at
+// fixed offsets from it.
+var bootTime = time.Unix(1_700_000_000, 500_000_000)
+
 // u64 returns a pointer to n; convenient for filling the *uint64 fields of
 // stats.FsStats with sentinel values.
 func u64(n uint64) *uint64 { return &n }
 
+// i64 returns a pointer to n, for the *int64 fields of stats.RlimitStats.
+func i64(n int64) *int64 { return &n }
+
 // pair is a (label name, label value) tuple used to build canonical label keys.
 type pair struct{ n, v string }
 
@@ -58,7 +83,8 @@ func key(pairs ...pair) string {
 }
 
 // gatherValues collects a registry into map[metric]map[labelsKey]value. Only
-// gauges are extracted since every metric this exporter emits is a gauge.
+// gauges and counters are extracted since those are the only types this
+// exporter emits.
 func gatherValues(t *testing.T, reg *prometheus.Registry) map[string]map[string]float64 {
 	t.Helper()
 	fams, err := reg.Gather()
@@ -69,16 +95,33 @@ func gatherValues(t *testing.T, reg *prometheus.Registry) map[string]map[string]
 	for _, fam := range fams {
 		mets := make(map[string]float64, len(fam.Metric))
 		for _, m := range fam.Metric {
-			if m.Gauge == nil {
-				continue
+			switch {
+			case m.Gauge != nil:
+				mets[labelsKey(m)] = m.Gauge.GetValue()
+			case m.Counter != nil:
+				mets[labelsKey(m)] = m.Counter.GetValue()
 			}
-			mets[labelsKey(m)] = m.Gauge.GetValue()
 		}
 		out[fam.GetName()] = mets
 	}
 	return out
 }
 
+// gatherTypes collects a registry into map[metric]type, so tests can assert
+// cumulative values are exposed as counters rather than gauges.
+func gatherTypes(t *testing.T, reg *prometheus.Registry) map[string]dto.MetricType {
+	t.Helper()
+	fams, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	out := make(map[string]dto.MetricType, len(fams))
+	for _, fam := range fams {
+		out[fam.GetName()] = fam.GetType()
+	}
+	return out
+}
+
 // fsStats builds a stats.FsStats populated with six distinct sentinel values
 // derived from base, so a label-position bug would surface as the wrong value
 // at the expected key rather than a coincidental match. usedBytes == base+3.
@@ -97,24 +140,106 @@ func fsStats(base uint64) stats.FsStats {
 // derived from base.
 func fsPtr(base uint64) *stats.FsStats { s := fsStats(base); return &s }
 
+// cpuStats returns a CPUStats whose usage is cores cores and whose cumulative
+// usage is seconds core-seconds, expressed in the kubelet's nano-units.
+func cpuStats(cores, seconds float64) *stats.CPUStats {
+	return &stats.CPUStats{
+		UsageNanoCores:       u64(uint64(cores * 1e9)),
+		UsageCoreNanoSeconds: u64(uint64(seconds * 1e9)),
+	}
+}
+
+// ifaceStats returns an InterfaceStats named name with four distinct sentinel
+// values derived from base, in field order: rxBytes == base+1 through
+// txErrors == base+4.
+func ifaceStats(name string, base uint64) stats.InterfaceStats {
+	return stats.InterfaceStats{
+		Name:     name,
+		RxBytes:  u64(base + 1),
+		RxErrors: u64(base + 2),
+		TxBytes:  u64(base + 3),
+		TxErrors: u64(base + 4),
+	}
+}
+
+// swapStats returns a SwapStats with usage and available bytes set.
+func swapStats(usage, available uint64) *stats.SwapStats {
+	return &stats.SwapStats{SwapUsageBytes: u64(usage), SwapAvailableBytes: u64(available)}
+}
+
+// psiStats returns a PSIStats in the kernel's units: totals in microseconds
+// and averages in percent. The some line reports 2s stalled and 10/20/30%
+// averages, the full line 0.5s and 1/2/3%.
+func psiStats() *stats.PSIStats {
+	return &stats.PSIStats{
+		Some: stats.PSIData{Total: 2_000_000, Avg10: 10, Avg60: 20, Avg300: 30},
+		Full: stats.PSIData{Total: 500_000, Avg10: 1, Avg60: 2, Avg300: 3},
+	}
+}
+
+// memStats returns a MemoryStats populated with six distinct sentinel values
+// derived from base, in field order: availableBytes == base+1 through
+// majorPageFaults == base+6.
+func memStats(base uint64) *stats.MemoryStats {
+	return &stats.MemoryStats{
+		AvailableBytes:  u64(base + 1),
+		UsageBytes:      u64(base + 2),
+		WorkingSetBytes: u64(base + 3),
+		RSSBytes:        u64(base + 4),
+		PageFaults:      u64(base + 5),
+		MajorPageFaults: u64(base + 6),
+	}
+}
+
 // buildSummary constructs a Summary for one node. Two pods (one carrying the
 // sharedUID below) each run two containers; one container has nil rootfs to
 // exercise the nil-skip path. Each pod has two volumes: one with a PVC ref
-// and one without. The node carries an ImageFs stats block.
+// and one without. The node, pod-a and its containers carry CPU and memory
+// stats, with PSI on a mix of CPU, memory and IO; the node also carries
+// nodefs and split ImageFs/ContainerFs stats blocks.
 func buildSummary(nodeName string, sharedUID string) *stats.Summary {
+	nodeCPU := cpuStats(0.25, 12.5)
+	nodeCPU.PSI = psiStats()
+	podMemory := memStats(900)
+	podMemory.PSI = psiStats()
+
 	return &stats.Summary{
 		Node: stats.NodeStats{
-			NodeName: nodeName,
+			NodeName:  nodeName,
+			StartTime: metav1.NewTime(bootTime),
+			Fs:        fsPtr(750),
 			Runtime: &stats.RuntimeStats{
-				ImageFs: fsPtr(700),
+				ImageFs:     fsPtr(700),
+				ContainerFs: fsPtr(710),
+			},
+			CPU:    nodeCPU,
+			Memory: memStats(800),
+			IO:     &stats.IOStats{PSI: psiStats()},
+			Swap:   swapStats(1700, 1701),
+			SystemContainers: []stats.ContainerStats{
+				{Name: stats.SystemContainerKubelet, CPU: cpuStats(0.05, 300), Memory: memStats(1500)},
+				{Name: stats.SystemContainerRuntime, CPU: cpuStats(0.15, 900), Memory: memStats(1600)},
+			},
+			Rlimit: &stats.RlimitStats{
+				MaxPID:                i64(4194304),
+				NumOfRunningProcesses: i64(1500),
+			},
+			// Interfaces lists every interface, including the default one the
+			// kubelet also inlines; only Interfaces must be emitted.
+			Network: &stats.NetworkStats{
+				InterfaceStats: ifaceStats("eth0", 1200),
+				Interfaces: []stats.InterfaceStats{
+					ifaceStats("eth0", 1200),
+					ifaceStats("eth1", 1300),
+				},
 			},
 		},
 		Pods: []stats.PodStats{
 			{
-				// All FsStats fields are nil pointers. collectSummaryMetrics
-				// must emit **no** series for this pod: the per-field nil
-				// guards inside collectFsStats/setGauge must skip every
-				// metric so a broken guard that emits gauge=0 shows up as an
+				// All FsStats fields are nil pointers. summaryCollector
+				// must emit **no** series for this pod: the nil checks in
+				// gauge and field in metrics.go must skip every metric so a
+				// broken check that emits gauge=0 shows up as an
 				// unexpected series.
 				PodRef: stats.PodReference{Name: "pod-empty", Namespace: "ns-a", UID: "uid-empty"},
 				Containers: []stats.ContainerStats{
@@ -123,16 +248,44 @@ func buildSummary(nodeName string, sharedUID string) *stats.Summary {
 				EphemeralStorage: &stats.FsStats{},
 			},
 			{
-				PodRef: stats.PodReference{Name: "pod-a", Namespace: "ns-a", UID: "uid-a"},
+				PodRef:    stats.PodReference{Name: "pod-a", Namespace: "ns-a", UID: "uid-a"},
+				StartTime: metav1.NewTime(bootTime.Add(time.Minute)),
 				Containers: []stats.ContainerStats{
-					{Name: "c1", Logs: fsPtr(100), Rootfs: fsPtr(110)},
-					{Name: "c2", Logs: fsPtr(200), Rootfs: fsPtr(210)},
+					{Name: "c1", StartTime: metav1.NewTime(bootTime.Add(2 * time.Minute)), Logs: fsPtr(100), Rootfs: fsPtr(110), CPU: cpuStats(0.1, 1.5), Memory: memStats(1000), Swap: swapStats(1900, 1901), IO: &stats.IOStats{PSI: psiStats()}},
+					{
+						Name: "c2", Logs: fsPtr(200), Rootfs: fsPtr(210), CPU: cpuStats(0.2, 2.5), Memory: memStats(1100),
+						Accelerators: []stats.AcceleratorStats{
+							{Make: "nvidia", Model: "tesla-t4", ID: "GPU-0", MemoryTotal: 16 << 30, MemoryUsed: 4 << 30, DutyCycle: 75},
+						},
+						// Only queue_depth is allowlisted; secret_value must
+						// not be exported. queue_depth is reported twice with
+						// different descriptor labels, which are dropped, so
+						// the last value must win without a duplicate series
+						// failing the scrape.
+						UserDefinedMetrics: []stats.UserDefinedMetric{
+							{UserDefinedMetricDescriptor: stats.UserDefinedMetricDescriptor{Name: "queue_depth", Type: stats.MetricGauge, Units: "items"}, Value: 17},
+							{UserDefinedMetricDescriptor: stats.UserDefinedMetricDescriptor{Name: "queue_depth", Type: stats.MetricGauge, Units: "items", Labels: map[string]string{"queue": "b"}}, Value: 18},
+							{UserDefinedMetricDescriptor: stats.UserDefinedMetricDescriptor{Name: "secret_value", Type: stats.MetricGauge}, Value: 99},
+						},
+					},
 				},
 				VolumeStats: []stats.VolumeStats{
-					{FsStats: fsStats(300), Name: "vol-a", PVCRef: &stats.PVCReference{Name: "pvc-a", Namespace: "ns-a"}},
+					{
+						FsStats: fsStats(300), Name: "vol-a", PVCRef: &stats.PVCReference{Name: "pvc-a", Namespace: "ns-a"},
+						VolumeHealthStats: &stats.VolumeHealthStats{Abnormal: true},
+					},
 					{FsStats: fsStats(310), Name: "vol-b"},
 				},
 				EphemeralStorage: fsPtr(400),
+				CPU:              cpuStats(0.5, 4),
+				Memory:           podMemory,
+				// Only the inline default interface is set, as older kubelets
+				// do; it must be emitted as the pod's sole interface.
+				Network: &stats.NetworkStats{
+					InterfaceStats: ifaceStats("eth0", 1400),
+				},
+				ProcessStats: &stats.ProcessStats{ProcessCount: u64(42)},
+				Swap:         swapStats(1800, 1801),
 			},
 			{
 				// Reuses sharedUID across two nodes to prove the exporter keys
@@ -146,7 +299,10 @@ func buildSummary(nodeName string, sharedUID string) *stats.Summary {
 					{Name: "c2", Logs: fsPtr(520), Rootfs: nil},
 				},
 				VolumeStats: []stats.VolumeStats{
-					{FsStats: fsStats(600), Name: "vol-a", PVCRef: &stats.PVCReference{Name: "pvc-shared", Namespace: "ns-a"}},
+					{
+						FsStats: fsStats(600), Name: "vol-a", PVCRef: &stats.PVCReference{Name: "pvc-shared", Namespace: "ns-a"},
+						VolumeHealthStats: &stats.VolumeHealthStats{Abnormal: false},
+					},
 				},
 				EphemeralStorage: fsPtr(410),
 			},
@@ -154,31 +310,27 @@ func buildSummary(nodeName string, sharedUID string) *stats.Summary {
 	}
 }
 
-// Test_collectSummaryMetrics verifies a representative subset of series per
+// Test_summaryCollector verifies a representative subset of series per
 // metric category are emitted with the expected values and labels. Asserting
 // specific (metric, label-set) -> value pairs, rather than diffing the whole
-// text exposition against a golden string, means adding a collector or a
+// text exposition against a golden string, means adding a metric or a
 // Prometheus library formatting change no longer breaks the test, while a
-// WithLabelValues label-position bug shows up as "expected series not found"
-// or a value mismatch. The fixture deliberately reuses one pod uid across
-// two nodes and asserts both nodes' series survive independently.
-func Test_collectSummaryMetrics(t *testing.T) {
+// label-position bug shows up as "expected series not found" or a value
+// mismatch. The fixture deliberately reuses one pod uid across two nodes and
+// asserts both nodes' series survive independently. The pedantic registry
+// additionally fails Gather if a collected metric was not described.
+func Test_summaryCollector(t *testing.T) {
 	const (
 		nodeA     = "node-a"
 		nodeB     = "node-b"
 		sharedUID = "shared-uid"
 	)
 
-	reg := prometheus.NewRegistry()
-	collectors := newCollectors()
-	collectors.register(reg)
-
-	for _, sum := range []*stats.Summary{
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(newSummaryCollector([]*stats.Summary{
 		buildSummary(nodeA, sharedUID),
 		buildSummary(nodeB, sharedUID),
-	} {
-		collectSummaryMetrics(sum, collectors)
-	}
+	}, map[string]bool{"queue_depth": true}))
 
 	got := gatherValues(t, reg)
 
@@ -252,6 +404,121 @@ func Test_collectSummaryMetrics(t *testing.T) {
 		mustAbsent("kube_summary_container_rootfs_used_bytes", contLabels(node, "pod-shared", "ns-a", sharedUID, "c2"))
 	}
 
+	// --- pod and container cpu/memory ---
+	for _, node := range []string{nodeA, nodeB} {
+		podLabels := ephLabels(node, "pod-a", "ns-a", "uid-a")
+		must("kube_summary_pod_cpu_usage_cores", podLabels, 0.5)
+		must("kube_summary_pod_cpu_usage_seconds_total", podLabels, 4)
+		must("kube_summary_pod_memory_working_set_bytes", podLabels, 903)
+		must("kube_summary_pod_memory_major_page_faults_total", podLabels, 906)
+
+		must("kube_summary_container_cpu_usage_cores", contLabels(node, "pod-a", "ns-a", "uid-a", "c1"), 0.1)
+		must("kube_summary_container_cpu_usage_seconds_total", contLabels(node, "pod-a", "ns-a", "uid-a", "c2"), 2.5)
+		must("kube_summary_container_memory_working_set_bytes", contLabels(node, "pod-a", "ns-a", "uid-a", "c1"), 1003)
+		must("kube_summary_container_memory_rss_bytes", contLabels(node, "pod-a", "ns-a", "uid-a", "c2"), 1104)
+
+		// pod-shared carries no CPU/memory stats at either level.
+		mustAbsent("kube_summary_pod_cpu_usage_cores", ephLabels(node, "pod-shared", "ns-a", sharedUID))
+		mustAbsent("kube_summary_container_memory_working_set_bytes", contLabels(node, "pod-shared", "ns-a", sharedUID, "c1"))
+	}
+
+	// --- node and pod network, per interface ---
+	for _, node := range []string{nodeA, nodeB} {
+		eth0 := []pair{{"node", node}, {"interface", "eth0"}}
+		eth1 := []pair{{"node", node}, {"interface", "eth1"}}
+		must("kube_summary_node_network_receive_bytes_total", eth0, 1201)
+		must("kube_summary_node_network_receive_errors_total", eth0, 1202)
+		must("kube_summary_node_network_transmit_bytes_total", eth1, 1303)
+		must("kube_summary_node_network_transmit_errors_total", eth1, 1304)
+
+		podEth0 := append(ephLabels(node, "pod-a", "ns-a", "uid-a"), pair{"interface", "eth0"})
+		must("kube_summary_pod_network_receive_bytes_total", podEth0, 1401)
+		must("kube_summary_pod_network_transmit_errors_total", podEth0, 1404)
+	}
+	// The default interface appears twice in the node fixture: the eth0
+	// values above would double if the inline copy were also added, and an
+	// extra series would appear if it were emitted on its own.
+	if n := len(got["kube_summary_node_network_receive_bytes_total"]); n != 4 {
+		t.Errorf("kube_summary_node_network_receive_bytes_total has %d series, want 4 (2 nodes x 2 interfaces)", n)
+	}
+
+	// --- node system containers ---
+	for _, node := range []string{nodeA, nodeB} {
+		kubelet := []pair{{"node", node}, {"system_container", "kubelet"}}
+		runtime := []pair{{"node", node}, {"system_container", "runtime"}}
+		must("kube_summary_node_system_container_cpu_usage_cores", kubelet, 0.05)
+		must("kube_summary_node_system_container_cpu_usage_seconds_total", runtime, 900)
+		must("kube_summary_node_system_container_memory_working_set_bytes", kubelet, 1503)
+		must("kube_summary_node_system_container_memory_rss_bytes", runtime, 1604)
+	}
+
+	// --- swap at node, pod and container level ---
+	for _, node := range []string{nodeA, nodeB} {
+		must("kube_summary_node_swap_usage_bytes", []pair{{"node", node}}, 1700)
+		must("kube_summary_node_swap_available_bytes", []pair{{"node", node}}, 1701)
+		must("kube_summary_pod_swap_usage_bytes", ephLabels(node, "pod-a", "ns-a", "uid-a"), 1800)
+		must("kube_summary_pod_swap_available_bytes", ephLabels(node, "pod-a", "ns-a", "uid-a"), 1801)
+		must("kube_summary_container_swap_usage_bytes", contLabels(node, "pod-a", "ns-a", "uid-a", "c1"), 1900)
+		must("kube_summary_container_swap_available_bytes", contLabels(node, "pod-a", "ns-a", "uid-a", "c1"), 1901)
+		// c2 carries no swap stats, so it gets no series rather than a zero.
+		mustAbsent("kube_summary_container_swap_usage_bytes", contLabels(node, "pod-a", "ns-a", "uid-a", "c2"))
+	}
+
+	// --- pressure stall information, per resource and kind ---
+	for _, node := range []string{nodeA, nodeB} {
+		psiLabels := func(base []pair, resource, kind string) []pair {
+			return append(base, pair{"resource", resource}, pair{"kind", kind})
+		}
+		nodeLabels := []pair{{"node", node}}
+		must("kube_summary_node_psi_stalled_seconds_total", psiLabels(nodeLabels, "cpu", "some"), 2)
+		must("kube_summary_node_psi_stalled_seconds_total", psiLabels(nodeLabels, "cpu", "full"), 0.5)
+		must("kube_summary_node_psi_avg10_ratio", psiLabels(nodeLabels, "io", "some"), 0.1)
+		must("kube_summary_node_psi_avg300_ratio", psiLabels(nodeLabels, "io", "full"), 0.03)
+		// The node has no memory PSI in the fixture.
+		mustAbsent("kube_summary_node_psi_avg10_ratio", psiLabels(nodeLabels, "memory", "some"))
+
+		podLabels := ephLabels(node, "pod-a", "ns-a", "uid-a")
+		must("kube_summary_pod_psi_avg60_ratio", psiLabels(podLabels, "memory", "some"), 0.2)
+		must("kube_summary_pod_psi_stalled_seconds_total", psiLabels(podLabels, "memory", "full"), 0.5)
+
+		c1 := contLabels(node, "pod-a", "ns-a", "uid-a", "c1")
+		must("kube_summary_container_psi_avg10_ratio", psiLabels(c1, "io", "full"), 0.01)
+		mustAbsent("kube_summary_container_psi_avg10_ratio", psiLabels(contLabels(node, "pod-a", "ns-a", "uid-a", "c2"), "io", "full"))
+	}
+
+	// --- start times, in seconds since the epoch; unset times emit nothing ---
+	for _, node := range []string{nodeA, nodeB} {
+		must("kube_summary_node_start_time_seconds", []pair{{"node", node}}, 1_700_000_000.5)
+		must("kube_summary_pod_start_time_seconds", ephLabels(node, "pod-a", "ns-a", "uid-a"), 1_700_000_060.5)
+		must("kube_summary_container_start_time_seconds", contLabels(node, "pod-a", "ns-a", "uid-a", "c1"), 1_700_000_120.5)
+		mustAbsent("kube_summary_pod_start_time_seconds", ephLabels(node, "pod-shared", "ns-a", sharedUID))
+		mustAbsent("kube_summary_container_start_time_seconds", contLabels(node, "pod-a", "ns-a", "uid-a", "c2"))
+	}
+
+	// --- container accelerators and allowlisted user-defined metrics ---
+	for _, node := range []string{nodeA, nodeB} {
+		gpu := append(contLabels(node, "pod-a", "ns-a", "uid-a", "c2"),
+			pair{"make", "nvidia"}, pair{"model", "tesla-t4"}, pair{"accelerator_id", "GPU-0"})
+		must("kube_summary_container_accelerator_memory_total_bytes", gpu, 16<<30)
+		must("kube_summary_container_accelerator_memory_used_bytes", gpu, 4<<30)
+		must("kube_summary_container_accelerator_duty_cycle_ratio", gpu, 0.75)
+
+		udm := func(name, units string) []pair {
+			return append(contLabels(node, "pod-a", "ns-a", "uid-a", "c2"),
+				pair{"metric", name}, pair{"type", "gauge"}, pair{"units", units})
+		}
+		must("kube_summary_container_user_defined_metric", udm("queue_depth", "items"), 18)
+		mustAbsent("kube_summary_container_user_defined_metric", udm("secret_value", ""))
+	}
+
+	// --- node rlimit and pod process counts ---
+	for _, node := range []string{nodeA, nodeB} {
+		must("kube_summary_node_rlimit_max_pids", []pair{{"node", node}}, 4194304)
+		must("kube_summary_node_rlimit_running_processes", []pair{{"node", node}}, 1500)
+		must("kube_summary_pod_process_count", ephLabels(node, "pod-a", "ns-a", "uid-a"), 42)
+		mustAbsent("kube_summary_pod_process_count", ephLabels(node, "pod-shared", "ns-a", sharedUID))
+	}
+
 	// --- pod ephemeral storage ---
 	for _, node := range []string{nodeA, nodeB} {
 		must("kube_summary_pod_ephemeral_storage_used_bytes", ephLabels(node, "pod-a", "ns-a", "uid-a"), expUsed(400))
@@ -268,11 +535,51 @@ func Test_collectSummaryMetrics(t *testing.T) {
 		must("kube_summary_pod_volume_storage_used_bytes", volLabels(node, "pod-shared", "ns-a", sharedUID, "vol-a", "pvc-shared", "ns-a"), expUsed(600))
 	}
 
+	// --- node fs (nodefs) ---
+	for _, node := range []string{nodeA, nodeB} {
+		must("kube_summary_node_fs_available_bytes", []pair{{"node", node}}, 751)
+		must("kube_summary_node_fs_used_bytes", []pair{{"node", node}}, expUsed(750))
+		must("kube_summary_node_fs_inodes_free", []pair{{"node", node}}, 754)
+	}
+
+	// --- pod volume health: only volumes with health stats get a series ---
+	for _, node := range []string{nodeA, nodeB} {
+		must("kube_summary_pod_volume_health_abnormal", volLabels(node, "pod-a", "ns-a", "uid-a", "vol-a", "pvc-a", "ns-a"), 1)
+		must("kube_summary_pod_volume_health_abnormal", volLabels(node, "pod-shared", "ns-a", sharedUID, "vol-a", "pvc-shared", "ns-a"), 0)
+		mustAbsent("kube_summary_pod_volume_health_abnormal", volLabels(node, "pod-a", "ns-a", "uid-a", "vol-b", "", ""))
+	}
+
 	// --- node runtime imagefs ---
 	for _, node := range []string{nodeA, nodeB} {
 		must("kube_summary_node_runtime_imagefs_used_bytes", []pair{{"node", node}}, expUsed(700))
 	}
 
+	// --- node runtime containerfs (split image filesystem) ---
+	for _, node := range []string{nodeA, nodeB} {
+		must("kube_summary_node_runtime_containerfs_used_bytes", []pair{{"node", node}}, expUsed(710))
+		must("kube_summary_node_runtime_containerfs_inodes_used", []pair{{"node", node}}, 716)
+	}
+
+	// --- node cpu: nano-units converted to cores and seconds ---
+	for _, node := range []string{nodeA, nodeB} {
+		must("kube_summary_node_cpu_usage_cores", []pair{{"node", node}}, 0.25)
+		must("kube_summary_node_cpu_usage_seconds_total", []pair{{"node", node}}, 12.5)
+	}
+	if typ := gatherTypes(t, reg)["kube_summary_node_cpu_usage_seconds_total"]; typ != dto.MetricType_COUNTER {
+		t.Errorf("kube_summary_node_cpu_usage_seconds_total type = %v, want COUNTER", typ)
+	}
+
+	// --- node memory: every field, since each maps to its own series ---
+	for _, node := range []string{nodeA, nodeB} {
+		nodeLabels := []pair{{"node", node}}
+		must("kube_summary_node_memory_available_bytes", nodeLabels, 801)
+		must("kube_summary_node_memory_usage_bytes", nodeLabels, 802)
+		must("kube_summary_node_memory_working_set_bytes", nodeLabels, 803)
+		must("kube_summary_node_memory_rss_bytes", nodeLabels, 804)
+		must("kube_summary_node_memory_page_faults_total", nodeLabels, 805)
+		must("kube_summary_node_memory_major_page_faults_total", nodeLabels, 806)
+	}
+
 	// --- shared uid must not collide across nodes ---
 	// pod-shared uses the same uid on both nodes; both series must survive
 	// with distinct node labels. The per-node asserts above already enforce
@@ -297,34 +604,34 @@ func Test_collectSummaryMetrics(t *testing.T) {
 	}
 }
 
-// Test_collectSummaryMetrics_Concurrent exercises the shared-Collectors write
-// path concurrently to confirm GaugeVecs are safe under -race. The production
-// allNodesHandler fans out scrapes in goroutines but collects sequentially;
-// this test nonetheless hammers the collectors from many goroutines to guard
-// against a future refactor that collects concurrently.
-func Test_collectSummaryMetrics_Concurrent(t *testing.T) {
+// Test_summaryCollector_Concurrent gathers one registry from many goroutines
+// to confirm Collect only reads the summaries and shared Descs and is safe
+// under -race. promhttp may gather concurrently when scrapes overlap, and
+// the Descs are package-level and shared by every request.
+func Test_summaryCollector_Concurrent(t *testing.T) {
 	const n = 32
+	summaries := make([]*stats.Summary, n)
+	for i := range summaries {
+		uid := "uid-" + strconv.Itoa(i%4) // reuse some uids across nodes
+		summaries[i] = buildSummary(fmt.Sprintf("node-%d", i), uid)
+	}
 	reg := prometheus.NewRegistry()
-	collectors := newCollectors()
-	collectors.register(reg)
+	reg.MustRegister(newSummaryCollector(summaries, nil))
 
 	var wg sync.WaitGroup
 	wg.Add(n)
 	for i := 0; i < n; i++ {
-		go func(i int) {
+		go func() {
 			defer wg.Done()
-			uid := "uid-" + strconv.Itoa(i%4) // reuse some uids to force contention
-			summary := buildSummary(fmt.Sprintf("node-%d", i), uid)
-			collectSummaryMetrics(summary, collectors)
-		}(i)
+			// Gather must succeed without erroring; the exact values are
+			// irrelevant here (the -race detector failing the build is the
+			// point).
+			if _, err := reg.Gather(); err != nil {
+				t.Errorf("concurrent Gather: %v", err)
+			}
+		}()
 	}
 	wg.Wait()
-
-	// Gather must succeed without erroring; the exact values are irrelevant
-	// here (the -race detector failing the build is the point).
-	if _, err := reg.Gather(); err != nil {
-		t.Fatalf("Gather after concurrent collect: %v", err)
-	}
 }
 
 // Test_scrapeMetrics verifies observe sets scrape_success to 1 on success and 0
@@ -358,3 +665,879 @@ func Test_scrapeMetrics(t *testing.T) {
 		t.Errorf("last_scrape_duration_seconds{node=node-bad} = %v (present=%v), want 3", v, ok)
 	}
 }
+
+// sampleValue returns the value of series in a text exposition body.
+func sampleValue(body, series string) (float64, bool) {
+	for _, line := range strings.Split(body, "\n") {
+		if v, ok := strings.CutPrefix(line, series+" "); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			return f, err == nil
+		}
+	}
+	return 0, false
+}
+
+// Test_summaryCache verifies set replaces a node's cached scrape and retain
+// drops the scrapes of other nodes, so nodes removed from the cluster stop
+// being served.
+func Test_summaryCache(t *testing.T) {
+	c := newSummaryCache()
+	c.set(nodeScrape{node: "node-a"})
+	c.set(nodeScrape{node: "node-b"})
+	c.set(nodeScrape{node: "node-b", err: fmt.Errorf("boom")})
+	c.retain([]string{"node-b"})
+
+	if _, ok := c.get("node-a"); ok {
+		t.Errorf("node-a still cached after it was dropped")
+	}
+	if s, ok := c.get("node-b"); !ok || s.err == nil {
+		t.Errorf("get(node-b) = %+v (present=%v), want the latest failed scrape", s, ok)
+	}
+	if list := c.list([]string{"node-a", "node-b"}); len(list) != 1 || list[0].node != "node-b" {
+		t.Errorf("list(node-a, node-b) = %+v, want only node-b", list)
+	}
+}
+
+// Test_pollOnce verifies a poll caches each node's scrape as soon as it
+// finishes rather than waiting on a hung node, which gives up after the fetch
+// timeout, and drops nodes no longer in the cluster.
+func Test_pollOnce(t *testing.T) {
+	e := &exporter{
+		nodeLister: newTestNodeLister(t,
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}},
+		),
+		fetchTimeout: 200 * time.Millisecond,
+		fetch: func(ctx context.Context, node string) (*stats.Summary, error) {
+			if node == "node-b" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return buildSummary(node, "uid"), nil
+		},
+		cache: newSummaryCache(),
+	}
+	e.cache.set(nodeScrape{node: "node-gone"})
+
+	done := make(chan struct{})
+	go func() {
+		e.pollOnce(context.Background(), time.Minute)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for {
+		if s, ok := e.cache.get("node-a"); ok && s.err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node-a not cached while node-b hangs")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("poll did not finish after node-b's fetch timeout")
+	}
+	if s, ok := e.cache.get("node-b"); !ok || !errors.Is(s.err, context.DeadlineExceeded) {
+		t.Errorf("get(node-b) = %+v (present=%v), want a deadline exceeded failure", s, ok)
+	}
+	if _, ok := e.cache.get("node-gone"); ok {
+		t.Errorf("node-gone still cached after the poll")
+	}
+}
+
+// Test_exporter_cached verifies that with a cache the handlers serve its
+// scrapes, including each node's cache age and the failure of a node whose
+// last poll failed, without a kube client to scrape with.
+func Test_exporter_cached(t *testing.T) {
+	fetched := time.Now().Add(-30 * time.Second)
+	e := &exporter{
+		nodeLister: newTestNodeLister(t,
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+			&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}},
+		),
+		cache: newSummaryCache(),
+	}
+	e.cache.set(nodeScrape{node: "node-a", summary: buildSummary("node-a", "uid-a"), duration: time.Second, time: fetched, fetched: fetched})
+	e.cache.set(nodeScrape{node: "node-b", err: fmt.Errorf("boom"), duration: time.Second, time: fetched})
+
+	rec := httptest.NewRecorder()
+	e.allNodesHandler(rec, httptest.NewRequest(http.MethodGet, "/nodes", nil))
+	body := rec.Body.String()
+	for series, want := range map[string]float64{
+		`kube_summary_node_cpu_usage_cores{node="node-a"}`:    0.25,
+		`kube_summary_exporter_scrape_success{node="node-a"}`: 1,
+		`kube_summary_exporter_scrape_success{node="node-b"}`: 0,
+	} {
+		if v, ok := sampleValue(body, series); !ok || v != want {
+			t.Errorf("%s = %v (present=%v), want %v", series, v, ok, want)
+		}
+	}
+	if v, ok := sampleValue(body, `kube_summary_exporter_cache_age_seconds{node="node-b"}`); !ok || v < 30 || v > 60 {
+		t.Errorf("cache_age_seconds{node=node-b} = %v (present=%v), want about 30", v, ok)
+	}
+	if _, ok := sampleValue(body, `kube_summary_node_cpu_usage_cores{node="node-b"}`); ok {
+		t.Errorf("/nodes serves summary metrics for node-b, whose last poll failed")
+	}
+
+	rec = httptest.NewRecorder()
+	e.nodeHandler(rec, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/node/node-c", nil), map[string]string{"node": "node-c"}))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/node/node-c status = %d, want %d for a node not in the cache", rec.Code, http.StatusNotFound)
+	}
+}
+
+// Test_lastGoodCache verifies a failed scrape is served with the node's last
+// successful summary within the window only, keeping its error.
+func Test_lastGoodCache(t *testing.T) {
+	start := time.Now()
+	good := buildSummary("node-a", "uid-a")
+	c := newLastGoodCache(time.Minute)
+
+	if s := c.resolve(nodeScrape{node: "node-a", err: fmt.Errorf("boom"), time: start}); s.summary != nil {
+		t.Errorf("failure before any success served a summary")
+	}
+	c.resolve(nodeScrape{node: "node-a", summary: good, time: start, fetched: start})
+
+	s := c.resolve(nodeScrape{node: "node-a", err: fmt.Errorf("boom"), time: start.Add(30 * time.Second)})
+	if s.summary != good || !s.fetched.Equal(start) || s.err == nil {
+		t.Errorf("failure within window = {summary: %p, fetched: %v, err: %v}, want {%p, %v, boom}", s.summary, s.fetched, s.err, good, start)
+	}
+	if s := c.resolve(nodeScrape{node: "node-b", err: fmt.Errorf("boom"), time: start.Add(30 * time.Second)}); s.summary != nil {
+		t.Errorf("failure of node-b served node-a's summary")
+	}
+	if s := c.resolve(nodeScrape{node: "node-a", err: fmt.Errorf("boom"), time: start.Add(2 * time.Minute)}); s.summary != nil {
+		t.Errorf("failure past window served a summary fetched at %v", s.fetched)
+	}
+	if _, ok := c.scrapes["node-a"]; ok {
+		t.Errorf("expired summary of node-a not pruned")
+	}
+}
+
+// Test_exporter_staleSummary verifies that a node whose scrape fails keeps
+// its summary metrics, reported with scrape_success 0 and their age.
+func Test_exporter_staleSummary(t *testing.T) {
+	var fail atomic.Bool
+	e := &exporter{
+		lastGood: newLastGoodCache(time.Minute),
+		fetch: func(ctx context.Context, node string) (*stats.Summary, error) {
+			if fail.Load() {
+				return nil, fmt.Errorf("boom")
+			}
+			return buildSummary(node, "uid"), nil
+		},
+	}
+	get := func() string {
+		rec := httptest.NewRecorder()
+		e.nodeHandler(rec, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/node/node-a", nil), map[string]string{"node": "node-a"}))
+		return rec.Body.String()
+	}
+
+	body := get()
+	if v, ok := sampleValue(body, `kube_summary_exporter_summary_age_seconds{node="node-a"}`); !ok || v > 1 {
+		t.Errorf("summary_age_seconds of a fresh summary = %v (present=%v), want about 0", v, ok)
+	}
+
+	fail.Store(true)
+	time.Sleep(10 * time.Millisecond)
+	body = get()
+	for series, want := range map[string]float64{
+		`kube_summary_node_cpu_usage_cores{node="node-a"}`:    0.25,
+		`kube_summary_exporter_scrape_success{node="node-a"}`: 0,
+	} {
+		if v, ok := sampleValue(body, series); !ok || v != want {
+			t.Errorf("%s = %v (present=%v), want %v", series, v, ok, want)
+		}
+	}
+	if v, ok := sampleValue(body, `kube_summary_exporter_summary_age_seconds{node="node-a"}`); !ok || v < 0.01 {
+		t.Errorf("summary_age_seconds of a stale summary = %v (present=%v), want at least 0.01", v, ok)
+	}
+}
+
+// Test_exporter_queueWait verifies the queue wait is only reported when
+// scrape slots are limited, as there is no queue otherwise.
+func Test_exporter_queueWait(t *testing.T) {
+	for _, slots := range []int{0, 2} {
+		e := &exporter{
+			fetch: func(ctx context.Context, node string) (*stats.Summary, error) {
+				return buildSummary(node, "uid"), nil
+			},
+		}
+		if slots > 0 {
+			e.scrapeSlots = make(chan struct{}, slots)
+		}
+		rec := httptest.NewRecorder()
+		e.nodeHandler(rec, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/node/node-a", nil), map[string]string{"node": "node-a"}))
+		_, ok := sampleValue(rec.Body.String(), `kube_summary_exporter_last_scrape_queue_wait_seconds{node="node-a"}`)
+		if ok != (slots > 0) {
+			t.Errorf("with %d scrape slots last_scrape_queue_wait_seconds present = %v, want %v", slots, ok, slots > 0)
+		}
+	}
+}
+
+// Test_exporter_staleSummary_skipped verifies that a node skipped for going
+// unready keeps its summary metrics next to node_skipped, with their age.
+func Test_exporter_staleSummary_skipped(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}}
+	node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+	indexer := newTestNodeIndexer(t, node)
+	e := &exporter{
+		skipUnready: true,
+		lastGood:    newLastGoodCache(time.Minute),
+		nodeLister:  listersv1.NewNodeLister(indexer),
+		fetch: func(ctx context.Context, node string) (*stats.Summary, error) {
+			return buildSummary(node, "uid"), nil
+		},
+	}
+	e.allNodesHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nodes", nil))
+
+	node = node.DeepCopy()
+	node.Status.Conditions[0].Status = corev1.ConditionFalse
+	if err := indexer.Update(node); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	e.allNodesHandler(rec, httptest.NewRequest(http.MethodGet, "/nodes", nil))
+	body := rec.Body.String()
+	for series, want := range map[string]float64{
+		`kube_summary_node_cpu_usage_cores{node="node-a"}`:                     0.25,
+		`kube_summary_exporter_node_skipped{node="node-a",reason="not_ready"}`: 1,
+	} {
+		if v, ok := sampleValue(body, series); !ok || v != want {
+			t.Errorf("%s = %v (present=%v), want %v", series, v, ok, want)
+		}
+	}
+	if _, ok := sampleValue(body, `kube_summary_exporter_summary_age_seconds{node="node-a"}`); !ok {
+		t.Errorf("summary_age_seconds{node=node-a} missing for a skipped node served from its last summary")
+	}
+	if _, ok := sampleValue(body, `kube_summary_exporter_scrape_success{node="node-a"}`); ok {
+		t.Errorf("scrape_success{node=node-a} reported for a skipped node")
+	}
+}
+
+// Test_scrapeNodes_maxConcurrency verifies scrape slots bound the fetches in
+// flight, that scrapes waiting for a slot record their queue wait, and that a
+// scrape whose context ends while queued fails alone.
+func Test_scrapeNodes_maxConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	e := &exporter{
+		scrapeSlots: make(chan struct{}, 2),
+		fetch: func(ctx context.Context, node string) (*stats.Summary, error) {
+			mu.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return buildSummary(node, "uid"), nil
+		},
+	}
+
+	nodes := []string{"node-0", "node-1", "node-2", "node-3", "node-4", "node-5"}
+	scrapes := e.scrapeNodes(context.Background(), nodes)
+	if len(scrapes) != len(nodes) {
+		t.Fatalf("scrapeNodes returned %d scrapes, want %d", len(scrapes), len(nodes))
+	}
+	if maxInFlight != 2 {
+		t.Errorf("max fetches in flight = %d, want 2", maxInFlight)
+	}
+	var maxQueueWait time.Duration
+	for _, s := range scrapes {
+		if s.err != nil {
+			t.Errorf("scrape of %s failed: %v", s.node, s.err)
+		}
+		maxQueueWait = max(maxQueueWait, s.queueWait)
+	}
+	// Six 20ms fetches through two slots: the last pair waits for two rounds.
+	if maxQueueWait < 30*time.Millisecond {
+		t.Errorf("max queue wait = %v, want at least 30ms", maxQueueWait)
+	}
+
+	// With every slot held, a scrape can only time out in the queue.
+	e.scrapeSlots <- struct{}{}
+	e.scrapeSlots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	s := e.scrapeNode(ctx, "node-0")
+	if !errors.Is(s.err, context.DeadlineExceeded) || s.queueWait < 10*time.Millisecond {
+		t.Errorf("queued scrape = {err: %v, queueWait: %v}, want a deadline exceeded after 10ms", s.err, s.queueWait)
+	}
+	<-e.scrapeSlots
+	<-e.scrapeSlots
+
+	// A spread longer than the scrape's deadline fails the scrapes still
+	// waiting to start rather than overrunning it.
+	e.scrapeSpread = time.Hour
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	for _, s := range e.scrapeNodes(ctx, nodes) {
+		if !errors.Is(s.err, context.DeadlineExceeded) {
+			t.Errorf("spread scrape of %s err = %v, want deadline exceeded", s.node, s.err)
+		}
+	}
+}
+
+// newTestNodeLister returns a NodeLister over nodes, standing in for the
+// informer's cache.
+func newTestNodeLister(t *testing.T, nodes ...*corev1.Node) listersv1.NodeLister {
+	t.Helper()
+	return listersv1.NewNodeLister(newTestNodeIndexer(t, nodes...))
+}
+
+// newTestNodeIndexer returns an informer-style store holding nodes, for tests
+// that change nodes after building a lister over it.
+func newTestNodeIndexer(t *testing.T, nodes ...*corev1.Node) cache.Indexer {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range nodes {
+		if err := indexer.Add(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return indexer
+}
+
+// Test_listNodes verifies nodes are listed from the informer's cache.
+func Test_listNodes(t *testing.T) {
+	e := &exporter{nodeLister: newTestNodeLister(t,
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}},
+	)}
+	nodes, _, err := e.listNodes(nodeFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(nodes)
+	if strings.Join(nodes, ",") != "node-a,node-b" {
+		t.Errorf("listNodes() = %q, want [node-a node-b]", nodes)
+	}
+
+	// Each shard lists only the nodes it owns.
+	var sharded []string
+	for index := 0; index < 2; index++ {
+		e.shard = shard{index: index, count: 2}
+		nodes, _, err := e.listNodes(nodeFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range nodes {
+			if !e.shard.owns(node) {
+				t.Errorf("shard %d listed node %s it does not own", index, node)
+			}
+		}
+		sharded = append(sharded, nodes...)
+	}
+	sort.Strings(sharded)
+	if strings.Join(sharded, ",") != "node-a,node-b" {
+		t.Errorf("shards listed %q, want [node-a node-b] between them", sharded)
+	}
+}
+
+// Test_nodeFilter verifies the /nodes query parameters select nodes by label,
+// field and name, and that invalid filters are rejected.
+func Test_nodeFilter(t *testing.T) {
+	node := func(name, pool string, unschedulable bool) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"pool": pool}},
+			Spec:       corev1.NodeSpec{Unschedulable: unschedulable},
+		}
+	}
+	e := &exporter{nodeLister: newTestNodeLister(t,
+		node("gpu-1", "gpu", false),
+		node("gpu-2", "gpu", true),
+		node("spot-1", "spot", false),
+	)}
+
+	for _, tc := range []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{query: "", want: "gpu-1,gpu-2,spot-1"},
+		{query: "labelSelector=pool%3Dgpu", want: "gpu-1,gpu-2"},
+		{query: "labelSelector=pool+in+(gpu,spot),pool!%3Dgpu", want: "spot-1"},
+		{query: "fieldSelector=spec.unschedulable%3Dfalse", want: "gpu-1,spot-1"},
+		{query: "fieldSelector=metadata.name!%3Dgpu-1", want: "gpu-2,spot-1"},
+		{query: "nameRegex=gpu-.*", want: "gpu-1,gpu-2"},
+		// The regex must match the whole name.
+		{query: "nameRegex=gpu", want: ""},
+		{query: "labelSelector=pool%3Dgpu&fieldSelector=spec.unschedulable%3Dfalse&nameRegex=.*-1", want: "gpu-1"},
+		{query: "labelSelector=pool%3D%3D%3D", wantErr: true},
+		{query: "fieldSelector=status.phase%3DRunning", wantErr: true},
+		{query: "nameRegex=(", wantErr: true},
+	} {
+		query, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filter, err := parseNodeFilter(query)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseNodeFilter(%q) error = %v, want error: %v", tc.query, err, tc.wantErr)
+			continue
+		}
+		if tc.wantErr {
+			continue
+		}
+		nodes, _, err := e.listNodes(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(nodes)
+		if got := strings.Join(nodes, ","); got != tc.want {
+			t.Errorf("listNodes(%q) = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	e.allNodesHandler(rec, httptest.NewRequest(http.MethodGet, "/nodes?nameRegex=(", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("/nodes?nameRegex=( status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+// Test_skipUnreadyNodes verifies /nodes skips nodes that are NotReady or
+// tainted unreachable without fetching their summaries, and reports them in
+// node_skipped instead.
+func Test_skipUnreadyNodes(t *testing.T) {
+	node := func(name string, ready corev1.ConditionStatus, taints ...corev1.Taint) *corev1.Node {
+		n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		n.Spec.Taints = taints
+		if ready != "" {
+			n.Status.Conditions = []corev1.NodeCondition{
+				{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse},
+				{Type: corev1.NodeReady, Status: ready},
+			}
+		}
+		return n
+	}
+	unreachable := corev1.Taint{Key: corev1.TaintNodeUnreachable, Effect: corev1.TaintEffectNoExecute}
+
+	var mu sync.Mutex
+	var fetched []string
+	e := &exporter{
+		skipUnready: true,
+		nodeLister: newTestNodeLister(t,
+			node("node-ready", corev1.ConditionTrue),
+			node("node-not-ready", corev1.ConditionFalse),
+			node("node-unknown", corev1.ConditionUnknown, unreachable),
+			node("node-registering", ""),
+		),
+		fetch: func(ctx context.Context, node string) (*stats.Summary, error) {
+			mu.Lock()
+			fetched = append(fetched, node)
+			mu.Unlock()
+			return buildSummary(node, "uid"), nil
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	e.allNodesHandler(rec, httptest.NewRequest(http.MethodGet, "/nodes", nil))
+	body := rec.Body.String()
+	if strings.Join(fetched, ",") != "node-ready" {
+		t.Errorf("fetched %q, want only node-ready", fetched)
+	}
+	if v, ok := sampleValue(body, `kube_summary_exporter_scrape_success{node="node-ready"}`); !ok || v != 1 {
+		t.Errorf("scrape_success{node=node-ready} = %v (present=%v), want 1", v, ok)
+	}
+	for node, reason := range map[string]string{
+		"node-not-ready":   "not_ready",
+		"node-unknown":     "unreachable",
+		"node-registering": "not_ready",
+	} {
+		series := fmt.Sprintf(`kube_summary_exporter_node_skipped{node=%q,reason=%q}`, node, reason)
+		if v, ok := sampleValue(body, series); !ok || v != 1 {
+			t.Errorf("%s = %v (present=%v), want 1", series, v, ok)
+		}
+		if _, ok := sampleValue(body, fmt.Sprintf(`kube_summary_exporter_scrape_success{node=%q}`, node)); ok {
+			t.Errorf("scrape_success present for skipped node %s", node)
+		}
+	}
+
+	// With skipping disabled every node is scraped.
+	e.skipUnready = false
+	fetched = nil
+	rec = httptest.NewRecorder()
+	e.allNodesHandler(rec, httptest.NewRequest(http.MethodGet, "/nodes", nil))
+	if len(fetched) != 4 {
+		t.Errorf("fetched %q with skipping disabled, want all 4 nodes", fetched)
+	}
+}
+
+// Test_trimNode verifies the fields dropped from cached Nodes are only those
+// the exporter never reads.
+func Test_trimNode(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:          "node-a",
+			Labels:        map[string]string{"pool": "gpu"},
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubelet"}},
+		},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}},
+			Images:    []corev1.ContainerImage{{Names: []string{"busybox"}}},
+		},
+	}
+	obj, err := trimNode(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trimmed := obj.(*corev1.Node)
+	if trimmed.ManagedFields != nil || trimmed.Status.Images != nil {
+		t.Errorf("trimNode kept managed fields or images: %+v", trimmed)
+	}
+	if trimmed.Labels["pool"] != "gpu" || len(trimmed.Status.Addresses) != 1 {
+		t.Errorf("trimNode dropped labels or addresses: %+v", trimmed)
+	}
+}
+
+// kubeletNode returns a node whose kubelet listens on port at addresses.
+func kubeletNode(name string, port int32, addresses ...corev1.NodeAddress) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	node.Status.Addresses = addresses
+	node.Status.DaemonEndpoints.KubeletEndpoint.Port = port
+	return node
+}
+
+// Test_kubeletURL verifies the kubelet is reached at the node's most
+// preferred address type and its reported kubelet port.
+func Test_kubeletURL(t *testing.T) {
+	preferred := []corev1.NodeAddressType{corev1.NodeInternalIP, corev1.NodeHostName}
+	for _, tc := range []struct {
+		name    string
+		node    *corev1.Node
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "preferred type",
+			node: kubeletNode("node-a", 10250,
+				corev1.NodeAddress{Type: corev1.NodeHostName, Address: "node-a.internal"},
+				corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			),
+			want: "https://10.0.0.1:10250/stats/summary",
+		},
+		{
+			name: "fallback type",
+			node: kubeletNode("node-a", 10250,
+				corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "203.0.113.1"},
+				corev1.NodeAddress{Type: corev1.NodeHostName, Address: "node-a.internal"},
+			),
+			want: "https://node-a.internal:10250/stats/summary",
+		},
+		{
+			name: "ipv6",
+			node: kubeletNode("node-a", 10250, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "fd00::1"}),
+			want: "https://[fd00::1]:10250/stats/summary",
+		},
+		{
+			name:    "no matching address",
+			node:    kubeletNode("node-a", 10250, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "203.0.113.1"}),
+			wantErr: true,
+		},
+		{
+			name:    "no kubelet port",
+			node:    kubeletNode("node-a", 0, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}),
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := kubeletURL(tc.node, preferred)
+			if (err != nil) != tc.wantErr || got != tc.want {
+				t.Errorf("kubeletURL() = %q, %v; want %q (error: %v)", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
+
+// Test_kubeletClient verifies summaries are fetched straight from the
+// kubelet with the client's bearer token, verifying the kubelet's serving
+// certificate against the configured CA file.
+func Test_kubeletClient(t *testing.T) {
+	kubelet := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats/summary" || r.Header.Get("Authorization") != "Bearer sa-token" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(buildSummary("node-a", "uid"))
+	}))
+	defer kubelet.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: kubelet.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	host, port, err := net.SplitHostPort(kubelet.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, _ := strconv.Atoi(port)
+	lister := newTestNodeLister(t, kubeletNode("node-a", int32(portNum), corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: host}))
+	addressTypes := []corev1.NodeAddressType{corev1.NodeInternalIP}
+
+	kc, err := newKubeletClient(&rest.Config{BearerToken: "sa-token"}, caFile, nodeKubeletURL(lister, addressTypes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := kc.nodeSummary(context.Background(), "node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Node.NodeName != "node-a" || len(summary.Pods) == 0 {
+		t.Errorf("nodeSummary() = node %q with %d pods, want node-a's fixture", summary.Node.NodeName, len(summary.Pods))
+	}
+
+	// Without the kubelet's CA its serving certificate cannot be verified.
+	kc, err = newKubeletClient(&rest.Config{BearerToken: "sa-token"}, "", nodeKubeletURL(lister, addressTypes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kc.nodeSummary(context.Background(), "node-a"); err == nil {
+		t.Errorf("nodeSummary() without the kubelet CA succeeded, want a certificate error")
+	}
+
+	if _, err := kc.nodeSummary(context.Background(), "node-b"); err == nil {
+		t.Errorf("nodeSummary() of an unknown node succeeded, want an error")
+	}
+}
+
+// Test_exporter_nodeLocal verifies that in node-local mode only the local
+// node is listed and scraped, at the kubelet address it was given.
+func Test_exporter_nodeLocal(t *testing.T) {
+	summaryURL := localKubeletURL("node-a", "10.0.0.1", 10250)
+	e := &exporter{
+		localNode: "node-a",
+		fetch: func(ctx context.Context, node string) (*stats.Summary, error) {
+			if _, err := summaryURL(node); err != nil {
+				return nil, err
+			}
+			return buildSummary(node, "uid"), nil
+		},
+	}
+
+	if u, err := summaryURL("node-a"); err != nil || u != "https://10.0.0.1:10250/stats/summary" {
+		t.Errorf("summaryURL(node-a) = %q, %v; want the local kubelet", u, err)
+	}
+	if _, err := summaryURL("node-b"); err == nil {
+		t.Errorf("summaryURL(node-b) succeeded, want an error for a remote node")
+	}
+
+	if nodes, _, err := e.listNodes(nodeFilter{}); err != nil || len(nodes) != 1 || nodes[0] != "node-a" {
+		t.Errorf("listNodes() = %q, %v; want only node-a", nodes, err)
+	}
+
+	rec := httptest.NewRecorder()
+	e.allNodesHandler(rec, httptest.NewRequest(http.MethodGet, "/nodes", nil))
+	if v, ok := sampleValue(rec.Body.String(), `kube_summary_exporter_scrape_success{node="node-a"}`); !ok || v != 1 {
+		t.Errorf("scrape_success{node=node-a} = %v (present=%v), want 1", v, ok)
+	}
+
+	for _, query := range []string{"labelSelector=role%3Dworker", "fieldSelector=spec.unschedulable%3Dfalse"} {
+		rec = httptest.NewRecorder()
+		e.allNodesHandler(rec, httptest.NewRequest(http.MethodGet, "/nodes?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("/nodes?%s status = %d, want %d in node-local mode", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	e.nodeHandler(rec, mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/node/node-b", nil), map[string]string{"node": "node-b"}))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/node/node-b status = %d, want %d for a remote node", rec.Code, http.StatusNotFound)
+	}
+}
+
+// Test_shard verifies every node is owned by exactly one shard, that nodes
+// are spread evenly, and that adding a shard only moves nodes to it.
+func Test_shard(t *testing.T) {
+	const nodes, count = 1000, 4
+	owners := make(map[string]int)
+	perShard := make([]int, count)
+	for i := 0; i < nodes; i++ {
+		node := fmt.Sprintf("ip-10-0-%d-%d.eu-west-1.compute.internal", i/256, i%256)
+		owned := 0
+		for index := 0; index < count; index++ {
+			if (shard{index: index, count: count}).owns(node) {
+				owners[node] = index
+				perShard[index]++
+				owned++
+			}
+		}
+		if owned != 1 {
+			t.Fatalf("node %s owned by %d shards, want 1", node, owned)
+		}
+	}
+	for index, n := range perShard {
+		if n < nodes/count*8/10 || n > nodes/count*12/10 {
+			t.Errorf("shard %d owns %d of %d nodes, want about %d", index, n, nodes, nodes/count)
+		}
+	}
+
+	for node, owner := range owners {
+		for index := 0; index <= count; index++ {
+			if (shard{index: index, count: count + 1}).owns(node) && index != owner && index != count {
+				t.Errorf("node %s moved from shard %d to %d when adding shard %d", node, owner, index, count)
+			}
+		}
+	}
+
+	if !(shard{}).owns("node-a") {
+		t.Errorf("unsharded exporter does not own node-a")
+	}
+}
+
+// Test_hostnameOrdinal verifies the shard index is taken from a StatefulSet
+// pod's hostname.
+func Test_hostnameOrdinal(t *testing.T) {
+	for _, tc := range []struct {
+		hostname string
+		want     int
+		wantErr  bool
+	}{
+		{"kube-summary-exporter-0", 0, false},
+		{"kube-summary-exporter-12", 12, false},
+		{"kube-summary-exporter-7d9f8b6c4-x2x9z", 0, true},
+		{"exporter", 0, true},
+	} {
+		got, err := hostnameOrdinal(tc.hostname)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("hostnameOrdinal(%q) = %d, %v; want %d (error: %v)", tc.hostname, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+// Test_collectSampleAges verifies each node-level stats block reports the age
+// of its kubelet sample relative to the scrape, and that blocks without a
+// sample time emit nothing rather than an age measured from the epoch.
+func Test_collectSampleAges(t *testing.T) {
+	now := bootTime.Add(time.Hour)
+	summary := &stats.Summary{Node: stats.NodeStats{
+		NodeName: "node-a",
+		CPU:      &stats.CPUStats{Time: metav1.NewTime(now.Add(-5 * time.Second))},
+		Fs:       &stats.FsStats{Time: metav1.NewTime(now.Add(-90 * time.Second))},
+		Memory:   &stats.MemoryStats{},
+	}}
+	collector := newSummaryCollector([]*stats.Summary{summary}, nil)
+	collector.now = now
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	ages := gatherValues(t, reg)["kube_summary_node_sample_age_seconds"]
+	for stat, want := range map[string]float64{"cpu": 5, "fs": 90} {
+		if v, ok := ages[key(pair{"node", "node-a"}, pair{"stats", stat})]; !ok || v != want {
+			t.Errorf("sample_age_seconds{stats=%s} = %v (present=%v), want %v", stat, v, ok, want)
+		}
+	}
+	if _, ok := ages[key(pair{"node", "node-a"}, pair{"stats", "memory"})]; ok {
+		t.Errorf("sample_age_seconds{stats=memory} present for a zero sample time")
+	}
+}
+
+// Test_splitList verifies comma-separated flag values are trimmed and empty
+// elements dropped, so "a, b," does not allowlist an empty metric name.
+func Test_splitList(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a, b,", []string{"a", "b"}},
+		{" , ", nil},
+	} {
+		got := splitList(tc.in)
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") || len(got) != len(tc.want) {
+			t.Errorf("splitList(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+// update rewrites generated files instead of testing them for drift.
+var update = flag.Bool("update", false, "rewrite the README metrics table from the metric tables")
+
+// readmeTableBegin and readmeTableEnd delimit the generated metrics table in
+// README.md.
+const (
+	readmeTableBegin = "<!-- BEGIN METRICS TABLE: generated by go test -run Test_readmeMetricsTable -update -->\n"
+	readmeTableEnd   = "<!-- END METRICS TABLE -->\n"
+)
+
+// metricsTable renders the README metrics table from the metric tables,
+// sorted by metric name.
+func metricsTable() string {
+	var docs []metricDoc
+	for _, s := range summaryMetricSets {
+		docs = append(docs, s.docs()...)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].name < docs[j].name })
+
+	var b strings.Builder
+	row := func(name, help, labels string) {
+		fmt.Fprintf(&b, "| %-50s | %-68s | %-31s |\n", name, help, labels)
+	}
+	row("Metric", "Description", "Labels")
+	row(strings.Repeat("-", 50), strings.Repeat("-", 68), strings.Repeat("-", 31))
+	for _, d := range docs {
+		row(d.name, d.help, strings.Join(d.labels, ", "))
+	}
+	return b.String()
+}
+
+// Test_readmeMetricsTable verifies the README metrics table matches the
+// metric tables, so documentation cannot drift from what is exported. Run
+// with -update to regenerate it.
+func Test_readmeMetricsTable(t *testing.T) {
+	readme, err := os.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, rest, ok := strings.Cut(string(readme), readmeTableBegin)
+	if !ok {
+		t.Fatalf("README.md has no %q marker", strings.TrimSpace(readmeTableBegin))
+	}
+	table, after, ok := strings.Cut(rest, readmeTableEnd)
+	if !ok {
+		t.Fatalf("README.md has no %q marker", strings.TrimSpace(readmeTableEnd))
+	}
+
+	want := metricsTable()
+	if *update {
+		if err := os.WriteFile("README.md", []byte(before+readmeTableBegin+want+readmeTableEnd+after), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if table != want {
+		t.Errorf("README.md metrics table is out of date; run go test -run Test_readmeMetricsTable -update\ngot:\n%s\nwant:\n%s", table, want)
+	}
+}
+
+// benchmarkGather measures serving one scrape of nodes summaries: building
+// the request-scoped registry, registering the summary collector and
+// gathering it. Exposition encoding is left out as it does not depend on how
+// the samples are produced.
+func benchmarkGather(b *testing.B, nodes int) {
+	summaries := make([]*stats.Summary, nodes)
+	for i := range summaries {
+		summaries[i] = buildSummary(fmt.Sprintf("node-%d", i), "shared-uid")
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(newSummaryCollector(summaries, nil))
+		if _, err := reg.Gather(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGather_1Node(b *testing.B)    { benchmarkGather(b, 1) }
+func BenchmarkGather_100Nodes(b *testing.B) { benchmarkGather(b, 100) }
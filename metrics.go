@@ -0,0 +1,448 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	stats "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+)
+
+// The metric tables below declare every metric exported from /stats/summary,
+// one table per level of the summary. They drive the collector's Describe and
+// Collect as well as the README metrics table, so exporting a new Summary
+// field takes a single entry here. After changing them, regenerate the README
+// with:
+//
+//	go test -run Test_readmeMetricsTable -update
+
+var nodeMetrics = newMetricSet(nodeLabelNames,
+	[]metric[*stats.NodeStats]{
+		timestamp("node_start_time_seconds", "Start time of the node since unix epoch in seconds", func(n *stats.NodeStats) metav1.Time { return n.StartTime }),
+	},
+	fsMetrics("node_fs", fsHelp("node filesystem"), func(n *stats.NodeStats) *stats.FsStats { return n.Fs }),
+	fsMetrics("node_runtime_imagefs", fsHelp("node Runtime ImageFS"), func(n *stats.NodeStats) *stats.FsStats {
+		if n.Runtime == nil {
+			return nil
+		}
+		return n.Runtime.ImageFs
+	}),
+	// ContainerFs holds the writable layers. When the runtime does not split
+	// them onto their own filesystem the kubelet reports the ImageFs stats
+	// here too, so both families carry the same values.
+	fsMetrics("node_runtime_containerfs", fsHelp("node Runtime ContainerFS"), func(n *stats.NodeStats) *stats.FsStats {
+		if n.Runtime == nil {
+			return nil
+		}
+		return n.Runtime.ContainerFs
+	}),
+	cpuMetrics("node", "node", func(n *stats.NodeStats) *stats.CPUStats { return n.CPU }),
+	memoryMetrics("node", [6]string{
+		"Number of bytes of memory available on the node, as used by the kubelet for memory-pressure eviction",
+		"Number of bytes of memory in use on the node, including page cache",
+		"Number of bytes of working set memory on the node",
+		"Number of bytes of anonymous and swap cache memory on the node",
+		"Cumulative number of minor page faults on the node",
+		"Cumulative number of major page faults on the node",
+	}, func(n *stats.NodeStats) *stats.MemoryStats { return n.Memory }),
+	psiMetrics("node", "node", func(n *stats.NodeStats) (*stats.CPUStats, *stats.MemoryStats, *stats.IOStats) {
+		return n.CPU, n.Memory, n.IO
+	}),
+	swapMetrics("node", "node", func(n *stats.NodeStats) *stats.SwapStats { return n.Swap }),
+	networkMetrics("node", "node", func(n *stats.NodeStats) *stats.NetworkStats { return n.Network }),
+	[]metric[*stats.NodeStats]{
+		gauge("node_rlimit_max_pids", "Maximum number of process IDs available on the node", field(func(n *stats.NodeStats) *stats.RlimitStats { return n.Rlimit }, func(r *stats.RlimitStats) *int64 { return r.MaxPID })),
+		gauge("node_rlimit_running_processes", "Number of processes running on the node", field(func(n *stats.NodeStats) *stats.RlimitStats { return n.Rlimit }, func(r *stats.RlimitStats) *int64 { return r.NumOfRunningProcesses })),
+		{
+			name:      "node_sample_age_seconds",
+			help:      "Time since the kubelet sampled the node's stats, in seconds",
+			valueType: prometheus.GaugeValue,
+			labels:    []string{"stats"},
+			collect:   collectSampleAges,
+		},
+	},
+)
+
+var systemContainerMetrics = newMetricSet(systemContainerLabelNames,
+	cpuMetrics("node_system_container", "system container", func(c *stats.ContainerStats) *stats.CPUStats { return c.CPU }),
+	memoryMetrics("node_system_container", memoryHelp("system container"), func(c *stats.ContainerStats) *stats.MemoryStats { return c.Memory }),
+)
+
+var podMetrics = newMetricSet(podLabelNames,
+	[]metric[*stats.PodStats]{
+		timestamp("pod_start_time_seconds", "Start time of the pod since unix epoch in seconds", func(p *stats.PodStats) metav1.Time { return p.StartTime }),
+	},
+	fsMetrics("pod_ephemeral_storage", [6]string{
+		"Number of bytes of Ephemeral storage that aren't consumed by the pod",
+		"Number of bytes of Ephemeral storage that can be consumed by the pod",
+		"Number of bytes of Ephemeral storage that are consumed by the pod",
+		"Number of available Inodes for pod Ephemeral storage",
+		"Number of Inodes for pod Ephemeral storage",
+		"Number of used Inodes for pod Ephemeral storage",
+	}, func(p *stats.PodStats) *stats.FsStats { return p.EphemeralStorage }),
+	cpuMetrics("pod", "pod", func(p *stats.PodStats) *stats.CPUStats { return p.CPU }),
+	memoryMetrics("pod", memoryHelp("pod"), func(p *stats.PodStats) *stats.MemoryStats { return p.Memory }),
+	psiMetrics("pod", "pod", func(p *stats.PodStats) (*stats.CPUStats, *stats.MemoryStats, *stats.IOStats) {
+		return p.CPU, p.Memory, p.IO
+	}),
+	swapMetrics("pod", "pod", func(p *stats.PodStats) *stats.SwapStats { return p.Swap }),
+	networkMetrics("pod", "pod", func(p *stats.PodStats) *stats.NetworkStats { return p.Network }),
+	[]metric[*stats.PodStats]{
+		gauge("pod_process_count", "Number of processes running in the pod", field(func(p *stats.PodStats) *stats.ProcessStats { return p.ProcessStats }, func(s *stats.ProcessStats) *uint64 { return s.ProcessCount })),
+	},
+)
+
+var containerMetrics = newMetricSet(containerLabelNames,
+	[]metric[*stats.ContainerStats]{
+		timestamp("container_start_time_seconds", "Start time of the container since unix epoch in seconds", func(c *stats.ContainerStats) metav1.Time { return c.StartTime }),
+	},
+	fsMetrics("container_logs", [6]string{
+		"Number of bytes that aren't consumed by the container logs",
+		"Number of bytes that can be consumed by the container logs",
+		"Number of bytes that are consumed by the container logs",
+		"Number of available Inodes for logs",
+		"Number of Inodes for logs",
+		"Number of used Inodes for logs",
+	}, func(c *stats.ContainerStats) *stats.FsStats { return c.Logs }),
+	fsMetrics("container_rootfs", [6]string{
+		"Number of bytes that aren't consumed by the container",
+		"Number of bytes that can be consumed by the container",
+		"Number of bytes that are consumed by the container",
+		"Number of available Inodes",
+		"Number of Inodes",
+		"Number of used Inodes",
+	}, func(c *stats.ContainerStats) *stats.FsStats { return c.Rootfs }),
+	cpuMetrics("container", "container", func(c *stats.ContainerStats) *stats.CPUStats { return c.CPU }),
+	memoryMetrics("container", memoryHelp("container"), func(c *stats.ContainerStats) *stats.MemoryStats { return c.Memory }),
+	swapMetrics("container", "container", func(c *stats.ContainerStats) *stats.SwapStats { return c.Swap }),
+	psiMetrics("container", "container", func(c *stats.ContainerStats) (*stats.CPUStats, *stats.MemoryStats, *stats.IOStats) {
+		return c.CPU, c.Memory, c.IO
+	}),
+	[]metric[*stats.ContainerStats]{
+		accelerator("container_accelerator_memory_total_bytes", "Total accelerator memory available to the container in bytes", func(a *stats.AcceleratorStats) float64 { return float64(a.MemoryTotal) }),
+		accelerator("container_accelerator_memory_used_bytes", "Accelerator memory used by the container in bytes", func(a *stats.AcceleratorStats) float64 { return float64(a.MemoryUsed) }),
+		accelerator("container_accelerator_duty_cycle_ratio", "Ratio of time the accelerator was actively processing over the kubelet's sample window", func(a *stats.AcceleratorStats) float64 { return float64(a.DutyCycle) / 100 }),
+		{
+			name:      "container_user_defined_metric",
+			help:      "Latest value of an allowlisted user-defined metric reported by the container",
+			valueType: prometheus.GaugeValue,
+			labels:    []string{"metric", "type", "units"},
+			collect:   collectUserDefinedMetrics,
+		},
+	},
+)
+
+var volumeMetrics = newMetricSet(volumeLabelNames,
+	fsMetrics("pod_volume_storage", [6]string{
+		"Number of bytes of Volume storage that aren't consumed by the pod",
+		"Number of bytes of Volume storage that can be consumed by the pod",
+		"Number of bytes of Volume storage that are consumed by the pod",
+		"Number of available Inodes for pod Volume storage",
+		"Number of Inodes for pod Volume storage",
+		"Number of used Inodes for pod Volume storage",
+	}, func(v *stats.VolumeStats) *stats.FsStats { return &v.FsStats }),
+	[]metric[*stats.VolumeStats]{
+		{
+			name:      "pod_volume_health_abnormal",
+			help:      "Whether the volume's CSI driver reports it as abnormal (1) or healthy (0)",
+			valueType: prometheus.GaugeValue,
+			collect: func(e *emitter, v *stats.VolumeStats) {
+				// Only CSI volumes with health monitoring carry health stats.
+				if health := v.VolumeHealthStats; health != nil {
+					abnormal := 0.0
+					if health.Abnormal {
+						abnormal = 1
+					}
+					e.emit(abnormal)
+				}
+			},
+		},
+	},
+)
+
+// summaryMetricSets lists every metric table, for Describe and the README.
+var summaryMetricSets = []describer{nodeMetrics, systemContainerMetrics, podMetrics, containerMetrics, volumeMetrics}
+
+// gauge declares a gauge of the value get returns, skipped when nil.
+func gauge[T any, V uint64 | int64](name, help string, get func(T) *V) metric[T] {
+	return metric[T]{
+		name:      name,
+		help:      help,
+		valueType: prometheus.GaugeValue,
+		collect: func(e *emitter, x T) {
+			if v := get(x); v != nil {
+				e.emit(float64(*v))
+			}
+		},
+	}
+}
+
+// scaled declares a metric of type typ of the value get returns multiplied by
+// scale, skipped when nil.
+func scaled[T any](name, help string, typ prometheus.ValueType, scale float64, get func(T) *uint64) metric[T] {
+	return metric[T]{
+		name:      name,
+		help:      help,
+		valueType: typ,
+		collect: func(e *emitter, x T) {
+			if v := get(x); v != nil {
+				e.emit(float64(*v) * scale)
+			}
+		},
+	}
+}
+
+// timestamp declares a gauge of the time get returns in seconds since the
+// unix epoch, skipped when unset.
+func timestamp[T any](name, help string, get func(T) metav1.Time) metric[T] {
+	return metric[T]{
+		name:      name,
+		help:      help,
+		valueType: prometheus.GaugeValue,
+		collect: func(e *emitter, x T) {
+			if t := get(x); !t.IsZero() {
+				e.emit(float64(t.UnixNano()) / 1e9)
+			}
+		},
+	}
+}
+
+// field returns a getter for the field get selects from the struct parent
+// returns, which yields nil when that struct is nil.
+func field[T, S, V any](parent func(T) *S, get func(*S) *V) func(T) *V {
+	return func(x T) *V {
+		if s := parent(x); s != nil {
+			return get(s)
+		}
+		return nil
+	}
+}
+
+// fsHelp returns the help texts of fsMetrics for a node-level filesystem.
+func fsHelp(what string) [6]string {
+	return [6]string{
+		fmt.Sprintf("Number of bytes of %s that aren't consumed", what),
+		fmt.Sprintf("Number of bytes of %s that can be consumed", what),
+		fmt.Sprintf("Number of bytes of %s that are consumed", what),
+		fmt.Sprintf("Number of available Inodes for %s", what),
+		fmt.Sprintf("Number of Inodes for %s", what),
+		fmt.Sprintf("Number of used Inodes for %s", what),
+	}
+}
+
+// fsMetrics declares the six metrics mirroring the fields of the FsStats fs
+// returns, in the order of help: available, capacity and used bytes, then
+// free, total and used inodes. Nil fields are skipped.
+func fsMetrics[T any](prefix string, help [6]string, fs func(T) *stats.FsStats) []metric[T] {
+	return []metric[T]{
+		gauge(prefix+"_available_bytes", help[0], field(fs, func(s *stats.FsStats) *uint64 { return s.AvailableBytes })),
+		gauge(prefix+"_capacity_bytes", help[1], field(fs, func(s *stats.FsStats) *uint64 { return s.CapacityBytes })),
+		gauge(prefix+"_used_bytes", help[2], field(fs, func(s *stats.FsStats) *uint64 { return s.UsedBytes })),
+		gauge(prefix+"_inodes_free", help[3], field(fs, func(s *stats.FsStats) *uint64 { return s.InodesFree })),
+		gauge(prefix+"_inodes", help[4], field(fs, func(s *stats.FsStats) *uint64 { return s.Inodes })),
+		gauge(prefix+"_inodes_used", help[5], field(fs, func(s *stats.FsStats) *uint64 { return s.InodesUsed })),
+	}
+}
+
+// cpuMetrics declares the metrics mirroring the fields of the CPUStats cpu
+// returns, converting the kubelet's nano-units to cores and seconds. Nil
+// fields are skipped.
+func cpuMetrics[T any](prefix, what string, cpu func(T) *stats.CPUStats) []metric[T] {
+	return []metric[T]{
+		scaled(prefix+"_cpu_usage_cores", fmt.Sprintf("CPU usage of the %s in cores, averaged over the kubelet's sample window", what), prometheus.GaugeValue, 1e-9, field(cpu, func(s *stats.CPUStats) *uint64 { return s.UsageNanoCores })),
+		scaled(prefix+"_cpu_usage_seconds_total", fmt.Sprintf("Cumulative CPU time consumed by the %s in core-seconds", what), prometheus.CounterValue, 1e-9, field(cpu, func(s *stats.CPUStats) *uint64 { return s.UsageCoreNanoSeconds })),
+	}
+}
+
+// memoryHelp returns the help texts of memoryMetrics for a pod or container.
+func memoryHelp(what string) [6]string {
+	return [6]string{
+		fmt.Sprintf("Number of bytes of memory available to the %s before reaching its limit", what),
+		fmt.Sprintf("Number of bytes of memory in use by the %s, including page cache", what),
+		fmt.Sprintf("Number of bytes of working set memory of the %s", what),
+		fmt.Sprintf("Number of bytes of anonymous and swap cache memory of the %s", what),
+		fmt.Sprintf("Cumulative number of minor page faults of the %s", what),
+		fmt.Sprintf("Cumulative number of major page faults of the %s", what),
+	}
+}
+
+// memoryMetrics declares the metrics mirroring the fields of the MemoryStats
+// memory returns, in the order of help: available, usage, working set and RSS
+// bytes, then minor and major page faults. Nil fields are skipped.
+func memoryMetrics[T any](prefix string, help [6]string, memory func(T) *stats.MemoryStats) []metric[T] {
+	return []metric[T]{
+		gauge(prefix+"_memory_available_bytes", help[0], field(memory, func(s *stats.MemoryStats) *uint64 { return s.AvailableBytes })),
+		gauge(prefix+"_memory_usage_bytes", help[1], field(memory, func(s *stats.MemoryStats) *uint64 { return s.UsageBytes })),
+		gauge(prefix+"_memory_working_set_bytes", help[2], field(memory, func(s *stats.MemoryStats) *uint64 { return s.WorkingSetBytes })),
+		gauge(prefix+"_memory_rss_bytes", help[3], field(memory, func(s *stats.MemoryStats) *uint64 { return s.RSSBytes })),
+		scaled(prefix+"_memory_page_faults_total", help[4], prometheus.CounterValue, 1, field(memory, func(s *stats.MemoryStats) *uint64 { return s.PageFaults })),
+		scaled(prefix+"_memory_major_page_faults_total", help[5], prometheus.CounterValue, 1, field(memory, func(s *stats.MemoryStats) *uint64 { return s.MajorPageFaults })),
+	}
+}
+
+// swapMetrics declares the metrics mirroring the fields of the SwapStats swap
+// returns. Nil fields are skipped.
+func swapMetrics[T any](prefix, what string, swap func(T) *stats.SwapStats) []metric[T] {
+	return []metric[T]{
+		gauge(prefix+"_swap_usage_bytes", fmt.Sprintf("Number of bytes of swap in use by the %s", what), field(swap, func(s *stats.SwapStats) *uint64 { return s.SwapUsageBytes })),
+		gauge(prefix+"_swap_available_bytes", fmt.Sprintf("Number of bytes of swap available to the %s", what), field(swap, func(s *stats.SwapStats) *uint64 { return s.SwapAvailableBytes })),
+	}
+}
+
+// networkMetrics declares the metrics mirroring the fields of every
+// interface in the NetworkStats network returns, labelled with the interface
+// name. The kubelet repeats the default interface inline and in Interfaces,
+// so the inline copy is only used when Interfaces is empty. Nil fields are
+// skipped.
+func networkMetrics[T any](prefix, what string, network func(T) *stats.NetworkStats) []metric[T] {
+	counter := func(name, help string, get func(*stats.InterfaceStats) *uint64) metric[T] {
+		return metric[T]{
+			name:      prefix + name,
+			help:      help,
+			valueType: prometheus.CounterValue,
+			labels:    []string{"interface"},
+			collect: func(e *emitter, x T) {
+				n := network(x)
+				if n == nil {
+					return
+				}
+				interfaces := n.Interfaces
+				if len(interfaces) == 0 && n.Name != "" {
+					interfaces = []stats.InterfaceStats{n.InterfaceStats}
+				}
+				for i := range interfaces {
+					if v := get(&interfaces[i]); v != nil {
+						e.emit(float64(*v), interfaces[i].Name)
+					}
+				}
+			},
+		}
+	}
+	return []metric[T]{
+		counter("_network_receive_bytes_total", fmt.Sprintf("Cumulative number of bytes received by the %s on the interface", what), func(s *stats.InterfaceStats) *uint64 { return s.RxBytes }),
+		counter("_network_receive_errors_total", fmt.Sprintf("Cumulative number of errors while receiving on the %s interface", what), func(s *stats.InterfaceStats) *uint64 { return s.RxErrors }),
+		counter("_network_transmit_bytes_total", fmt.Sprintf("Cumulative number of bytes transmitted by the %s on the interface", what), func(s *stats.InterfaceStats) *uint64 { return s.TxBytes }),
+		counter("_network_transmit_errors_total", fmt.Sprintf("Cumulative number of errors while transmitting on the %s interface", what), func(s *stats.InterfaceStats) *uint64 { return s.TxErrors }),
+	}
+}
+
+// psiMetrics declares the metrics mirroring the PSIData of whichever of the
+// cpu, memory and io stats psi returns carry pressure stall information; any
+// of them may be nil. Each series is labelled with the resource (cpu, memory,
+// io) and kind (some, full) it describes. The kernel reports totals in
+// microseconds and averages as percentages; both are converted to base units.
+func psiMetrics[T any](prefix, what string, psi func(T) (*stats.CPUStats, *stats.MemoryStats, *stats.IOStats)) []metric[T] {
+	m := func(name, help string, typ prometheus.ValueType, get func(stats.PSIData) float64) metric[T] {
+		emit := func(e *emitter, s *stats.PSIStats, resource string) {
+			e.emit(get(s.Some), resource, "some")
+			e.emit(get(s.Full), resource, "full")
+		}
+		return metric[T]{
+			name:      prefix + name,
+			help:      help,
+			valueType: typ,
+			labels:    []string{"resource", "kind"},
+			collect: func(e *emitter, x T) {
+				cpu, memory, io := psi(x)
+				if cpu != nil && cpu.PSI != nil {
+					emit(e, cpu.PSI, "cpu")
+				}
+				if memory != nil && memory.PSI != nil {
+					emit(e, memory.PSI, "memory")
+				}
+				if io != nil && io.PSI != nil {
+					emit(e, io.PSI, "io")
+				}
+			},
+		}
+	}
+	return []metric[T]{
+		m("_psi_stalled_seconds_total", fmt.Sprintf("Cumulative time the %s's tasks were stalled on the resource, in seconds", what), prometheus.CounterValue, func(d stats.PSIData) float64 { return float64(d.Total) * 1e-6 }),
+		m("_psi_avg10_ratio", fmt.Sprintf("Ratio of time the %s's tasks were stalled on the resource over the last 10 seconds", what), prometheus.GaugeValue, func(d stats.PSIData) float64 { return d.Avg10 / 100 }),
+		m("_psi_avg60_ratio", fmt.Sprintf("Ratio of time the %s's tasks were stalled on the resource over the last 60 seconds", what), prometheus.GaugeValue, func(d stats.PSIData) float64 { return d.Avg60 / 100 }),
+		m("_psi_avg300_ratio", fmt.Sprintf("Ratio of time the %s's tasks were stalled on the resource over the last 300 seconds", what), prometheus.GaugeValue, func(d stats.PSIData) float64 { return d.Avg300 / 100 }),
+	}
+}
+
+// accelerator declares a gauge of the value get returns for every
+// accelerator attached to a container, labelled with its make, model and id.
+func accelerator(name, help string, get func(*stats.AcceleratorStats) float64) metric[*stats.ContainerStats] {
+	return metric[*stats.ContainerStats]{
+		name:      name,
+		help:      help,
+		valueType: prometheus.GaugeValue,
+		labels:    []string{"make", "model", "accelerator_id"},
+		collect: func(e *emitter, c *stats.ContainerStats) {
+			for i := range c.Accelerators {
+				a := &c.Accelerators[i]
+				e.emit(get(a), a.Make, a.Model, a.ID)
+			}
+		},
+	}
+}
+
+// collectUserDefinedMetrics sends the allowlisted user-defined metrics of a
+// container. The descriptor's own labels are dropped to keep cardinality
+// bounded by the allowlist, so entries differing only in those labels
+// collapse into one series; the last value wins, as a series can only be
+// sent once per scrape.
+func collectUserDefinedMetrics(e *emitter, c *stats.ContainerStats) {
+	type udmKey struct {
+		name, typ, units string
+	}
+	var latest map[udmKey]float64
+	var order []udmKey
+	for _, udm := range c.UserDefinedMetrics {
+		if !e.userDefinedMetrics[udm.Name] {
+			continue
+		}
+		if latest == nil {
+			latest = make(map[udmKey]float64)
+		}
+		k := udmKey{udm.Name, string(udm.Type), udm.Units}
+		if _, ok := latest[k]; !ok {
+			order = append(order, k)
+		}
+		latest[k] = udm.Value
+	}
+	for _, k := range order {
+		e.emit(latest[k], k.name, k.typ, k.units)
+	}
+}
+
+// collectSampleAges sends the age of each node-level stats block, measured
+// from the time the kubelet sampled it to now. The kubelet serves
+// /stats/summary from caches refreshed on their own schedules (filesystem
+// stats far less often than CPU and memory), and a stuck cache otherwise
+// shows up as series that are flat but look healthy.
+func collectSampleAges(e *emitter, node *stats.NodeStats) {
+	age := func(block string, t metav1.Time) {
+		if !t.IsZero() {
+			e.emit(e.now.Sub(t.Time).Seconds(), block)
+		}
+	}
+	if node.CPU != nil {
+		age("cpu", node.CPU.Time)
+	}
+	if node.Memory != nil {
+		age("memory", node.Memory.Time)
+	}
+	if node.Network != nil {
+		age("network", node.Network.Time)
+	}
+	if node.Fs != nil {
+		age("fs", node.Fs.Time)
+	}
+	if node.Runtime != nil && node.Runtime.ImageFs != nil {
+		age("imagefs", node.Runtime.ImageFs.Time)
+	}
+	if node.Runtime != nil && node.Runtime.ContainerFs != nil {
+		age("containerfs", node.Runtime.ContainerFs.Time)
+	}
+	if node.Rlimit != nil {
+		age("rlimit", node.Rlimit.Time)
+	}
+	if node.Swap != nil {
+		age("swap", node.Swap.Time)
+	}
+}
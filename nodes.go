@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+)
+
+// nodeCacheSyncTimeout bounds how long startup waits for the node informer's
+// initial list, so an unreachable apiserver fails the exporter rather than
+// leaving it hanging.
+const nodeCacheSyncTimeout = time.Minute
+
+// newNodeLister starts a shared informer maintaining the cluster's nodes
+// until ctx is done, and returns a lister over it once its cache has synced.
+// Listing from the informer's cache means /nodes no longer issues a LIST
+// against the apiserver on every scrape, and keeps working from the last
+// known nodes while the apiserver is briefly unavailable.
+func newNodeLister(ctx context.Context, kubeClient kubernetes.Interface) (listersv1.NodeLister, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(kubeClient, 0, informers.WithTransform(trimNode))
+	lister := factory.Core().V1().Nodes().Lister()
+	factory.Start(ctx.Done())
+
+	syncCtx, cancel := context.WithTimeout(ctx, nodeCacheSyncTimeout)
+	defer cancel()
+	for typ, synced := range factory.WaitForCacheSync(syncCtx.Done()) {
+		if !synced {
+			return nil, fmt.Errorf("timed out waiting for %v informer to sync", typ)
+		}
+	}
+	return lister, nil
+}
+
+// trimNode drops the fields of cached Nodes the exporter never reads. The
+// managed fields and the images present on the node make up most of a Node,
+// and the informer keeps every node in memory.
+func trimNode(obj any) (any, error) {
+	if node, ok := obj.(*corev1.Node); ok {
+		node.ManagedFields = nil
+		node.Status.Images = nil
+	}
+	return obj, nil
+}
+
+// listNodes returns the names of the nodes in the cluster matching filter and
+// owned by e's shard, as last seen by the node informer. Matching nodes that
+// are unready are returned as skipped scrapes instead, if e.skipUnready is
+// set, carrying their last successful summary if it is recent enough. In
+// node-local mode it returns the local node if it matches filter's name
+// regex; allNodesHandler rejects selectors there, as the local node is not
+// looked up.
+func (e *exporter) listNodes(filter nodeFilter) (nodes []string, skipped []nodeScrape, err error) {
+	if e.localNode != "" {
+		if filter.name != nil && !filter.name.MatchString(e.localNode) {
+			return nil, nil, nil
+		}
+		return []string{e.localNode}, nil, nil
+	}
+
+	selector := filter.labels
+	if selector == nil {
+		selector = labels.Everything()
+	}
+	all, err := e.nodeLister.List(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes = make([]string, 0, len(all))
+	for _, node := range all {
+		if !filter.matches(node) || !e.shard.owns(node.Name) {
+			continue
+		}
+		if reason := unreadyReason(node); e.skipUnready && reason != "" {
+			skipped = append(skipped, e.withLastGood(nodeScrape{node: node.Name, skipped: reason, time: time.Now()}))
+			continue
+		}
+		nodes = append(nodes, node.Name)
+	}
+	return nodes, skipped, nil
+}
+
+// unreadyReason returns why node is unready, or "" if it is ready: the node
+// controller has tainted it unreachable, or its Ready condition is not True.
+// The kubelet of an unready node usually doesn't answer, and waiting for it
+// would hold the whole scrape until it times out.
+func unreadyReason(node *corev1.Node) string {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == corev1.TaintNodeUnreachable {
+			return "unreachable"
+		}
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady && cond.Status == corev1.ConditionTrue {
+			return ""
+		}
+	}
+	return "not_ready"
+}
+
+// nodeFields are the fields a node field selector can match on, as supported
+// by the apiserver for nodes.
+var nodeFields = map[string]func(*corev1.Node) string{
+	"metadata.name":      func(n *corev1.Node) string { return n.Name },
+	"spec.unschedulable": func(n *corev1.Node) string { return strconv.FormatBool(n.Spec.Unschedulable) },
+}
+
+// nodeFilter selects the nodes served by a /nodes request. Nil selectors
+// match every node.
+type nodeFilter struct {
+	labels labels.Selector
+	fields fields.Selector
+	name   *regexp.Regexp
+}
+
+// parseNodeFilter parses the labelSelector, fieldSelector and nameRegex query
+// parameters of a /nodes request. Selectors use the Kubernetes API syntax,
+// and nameRegex must match the whole node name, as in Prometheus relabelling.
+func parseNodeFilter(query url.Values) (nodeFilter, error) {
+	var f nodeFilter
+	if v := query.Get("labelSelector"); v != "" {
+		sel, err := labels.Parse(v)
+		if err != nil {
+			return f, fmt.Errorf("labelSelector: %w", err)
+		}
+		f.labels = sel
+	}
+	if v := query.Get("fieldSelector"); v != "" {
+		sel, err := fields.ParseSelector(v)
+		if err != nil {
+			return f, fmt.Errorf("fieldSelector: %w", err)
+		}
+		for _, req := range sel.Requirements() {
+			if _, ok := nodeFields[req.Field]; !ok {
+				return f, fmt.Errorf("fieldSelector: field %q is not supported for nodes", req.Field)
+			}
+		}
+		f.fields = sel
+	}
+	if v := query.Get("nameRegex"); v != "" {
+		re, err := regexp.Compile("^(?:" + v + ")$")
+		if err != nil {
+			return f, fmt.Errorf("nameRegex: %w", err)
+		}
+		f.name = re
+	}
+	return f, nil
+}
+
+// matches reports whether node matches the field selector and name regex of
+// f. The label selector is applied when listing.
+func (f nodeFilter) matches(node *corev1.Node) bool {
+	if f.fields != nil {
+		set := make(fields.Set, len(nodeFields))
+		for field, value := range nodeFields {
+			set[field] = value(node)
+		}
+		if !f.fields.Matches(set) {
+			return false
+		}
+	}
+	return f.name == nil || f.name.MatchString(node.Name)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// shard identifies the subset of nodes an exporter replica serves when /nodes
+// is split across count replicas. Nodes are assigned by rendezvous hashing:
+// every replica computes the same owner for a node from its name alone, so
+// replicas need no coordination, and changing count only moves the nodes
+// gained or lost by the shards added or removed.
+type shard struct {
+	index int
+	count int
+}
+
+// enabled reports whether nodes are split across more than one shard.
+func (s shard) enabled() bool {
+	return s.count > 1
+}
+
+// owns reports whether node belongs to s, i.e. whether s's index scores
+// highest for node among all count shards.
+func (s shard) owns(node string) bool {
+	if !s.enabled() {
+		return true
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(node))
+	sum := h.Sum64()
+
+	owner, best := 0, uint64(0)
+	for i := 0; i < s.count; i++ {
+		if score := mix64(sum + uint64(i)*0x9e3779b97f4a7c15); i == 0 || score > best {
+			owner, best = i, score
+		}
+	}
+	return owner == s.index
+}
+
+// mix64 is the splitmix64 finalizer. FNV alone mixes its last bytes poorly,
+// which would skew the scores of consecutive shard indexes.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// hostnameOrdinal returns the ordinal a StatefulSet appends to its pods'
+// hostnames, e.g. 2 for kube-summary-exporter-2.
+func hostnameOrdinal(hostname string) (int, error) {
+	i := strings.LastIndexByte(hostname, '-')
+	ordinal, err := strconv.Atoi(hostname[i+1:])
+	if i < 0 || err != nil || ordinal < 0 {
+		return 0, fmt.Errorf("hostname %q does not end in a StatefulSet ordinal", hostname)
+	}
+	return ordinal, nil
+}